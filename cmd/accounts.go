@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+const accountPurgeBatchSize = 100
+
+func (app *application) exportUserData(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	format := app.readString(r.URL.Query(), "format", "json")
+	v.Check(format == "json" || format == "zip", "format", "must be either json or zip")
+
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	export, err := app.core.ExportUserData(r.Context(), user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-export-%s", user.Username, export.ExportedAt.Format("20060102"))
+
+	if format == "json" {
+		headers := http.Header{}
+		headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		if err := app.writeJSON(w, http.StatusOK, envelope{"export": export}, headers); err != nil {
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"articles.json", export.Articles},
+		{"comments.json", export.Comments},
+		{"favorites.json", export.Favorites},
+		{"follows.json", envelope{"following": export.Following, "followers": export.Followers}},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		fileWriter, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			app.logger.Error("failed to create export archive entry", "error", err.Error(), "file", file.name)
+			return
+		}
+
+		encoder := json.NewEncoder(fileWriter)
+		encoder.SetIndent("", "\t")
+		if err := encoder.Encode(file.data); err != nil {
+			app.logger.Error("failed to write export archive entry", "error", err.Error(), "file", file.name)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		app.logger.Error("failed to close export archive", "error", err.Error())
+	}
+}
+
+func (app *application) deleteUser(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	articlePolicy := app.readString(r.URL.Query(), "articles", core.ArticlePolicyAnonymize)
+	v.Check(core.IsValidArticlePolicy(articlePolicy), "articles", "must be either anonymize or remove")
+
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	purgeAfter := time.Now().Add(app.config.AccountDeletionGracePeriod)
+
+	deletion, err := app.core.ScheduleAccountDeletion(r.Context(), user.ID, articlePolicy, purgeAfter)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auth.InvalidateCachedUser(user.ID)
+
+	if err := app.writeJSON(w, http.StatusAccepted, envelope{"deletion": deletion}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// purgeDeletedAccounts is the recurring job that purges the accounts whose deletion grace period has
+// expired. An account that fails to purge fails the job, so it is retried without waiting for the next run.
+func (app *application) purgeDeletedAccounts(ctx context.Context, _ struct{}) error {
+	deletions, err := app.core.GetAccountsDueForPurge(ctx, time.Now(), accountPurgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, deletion := range deletions {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var uploads []*models.Upload
+		err := app.session.DoTransactionally(ctx, func(txCtx context.Context) error {
+			var err error
+			if uploads, err = app.core.GetUploadsByUserId(txCtx, deletion.UserID); err != nil {
+				return err
+			}
+			return app.core.PurgeAccount(txCtx, deletion)
+		})
+		if err != nil {
+			app.logger.Error("failed to purge account", "user_id", deletion.UserID, "error", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		app.auth.InvalidateCachedUser(deletion.UserID)
+
+		// the files are removed once their rows are gone, a file that fails to delete is only logged
+		for _, upload := range uploads {
+			app.deleteStoredImage(upload)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/siahsang/blog/internal/analytics"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+const (
+	// statsDefaultDays is the range of the stats when none is given, ending today.
+	statsDefaultDays = 30
+	// statsMaxDays bounds the range of the stats.
+	statsMaxDays = 366
+	// statsTopReferrers is how many referrers the stats list.
+	statsTopReferrers = 10
+)
+
+// recordView counts a view of the article, unless the viewer is its author.
+func (app *application) recordView(r *http.Request, article *models.Article, viewer *auth.User) {
+	var viewerKey string
+	switch {
+	case viewer != nil && viewer.ID == article.AuthorID:
+		return
+	case viewer != nil:
+		viewerKey = app.views.UserViewer(viewer.ID)
+	default:
+		address, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			address = r.RemoteAddr
+		}
+		viewerKey = app.views.AnonymousViewer(address, r.UserAgent())
+	}
+
+	siteHost := ""
+	if siteURL, err := url.Parse(app.config.SiteURL); err == nil {
+		siteHost = siteURL.Hostname()
+	}
+	app.views.Record(article.ID, viewerKey, analytics.ReferrerHost(r.Referer(), siteHost), time.Now())
+}
+
+// runViewFlusher adds the views counted in memory to the database until ctx is cancelled, and once more
+// after that so the views counted last aren't lost on shutdown.
+func (app *application) runViewFlusher(ctx context.Context) {
+	ticker := time.NewTicker(app.config.ViewFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			app.flushViews(flushCtx)
+			return
+		case <-ticker.C:
+			app.flushViews(ctx)
+		}
+	}
+}
+
+func (app *application) flushViews(ctx context.Context) {
+	views := app.views.Drain()
+	if len(views) == 0 {
+		return
+	}
+
+	err := app.session.DoTransactionally(ctx, func(txCtx context.Context) error {
+		return app.core.AddArticleViews(txCtx, views)
+	})
+	if err != nil {
+		// the views are saved with the next flush, or lost if the instance stops first
+		app.views.Restore(views)
+		app.logger.Error("failed to save article views", "error", err.Error())
+	}
+}
+
+// getUserStats serves GET /api/user/stats: the daily views, favorites and comments of the articles of the
+// authenticated user, the top referrers of the views and the growth of the followers over a range of
+// days (UTC), the last 30 days by default.
+func (app *application) getUserStats(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := app.readDate(query, "to", today, v)
+	from := app.readDate(query, "from", to.AddDate(0, 0, -(statsDefaultDays-1)), v)
+	v.Check(!from.After(to), "from", "must not be after to")
+	v.Check(!to.After(from.AddDate(0, 0, statsMaxDays-1)), "to", fmt.Sprintf("range must be a maximum of %d days", statsMaxDays))
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	articles, err := app.core.GetArticleStats(r.Context(), user.ID, from, to)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	referrers, err := app.core.GetTopReferrers(r.Context(), user.ID, from, to, statsTopReferrers)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	followers, err := app.core.GetFollowerGrowth(r.Context(), user.ID, from, to)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{
+		"stats": envelope{
+			"from":      from.Format(time.DateOnly),
+			"to":        to.Format(time.DateOnly),
+			"articles":  articles,
+			"referrers": referrers,
+			"followers": followers,
+		},
+	}
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
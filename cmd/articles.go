@@ -12,6 +12,8 @@ import (
 	"github.com/siahsang/blog/internal/auth"
 	"github.com/siahsang/blog/internal/core"
 	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/markdown"
+	"github.com/siahsang/blog/internal/tagging"
 	"github.com/siahsang/blog/internal/utils/collectionutils"
 	"github.com/siahsang/blog/internal/utils/databaseutils"
 	"github.com/siahsang/blog/internal/utils/functional"
@@ -25,6 +27,7 @@ func (app *application) createArticle(w http.ResponseWriter, r *http.Request) {
 		Description string    `json:"description"`
 		Body        string    `json:"body"`
 		TagList     *[]string `json:"tagList"`
+		CoverImage  *string   `json:"coverImage"`
 	}
 
 	type CreateArticleRequest struct {
@@ -45,73 +48,60 @@ func (app *application) createArticle(w http.ResponseWriter, r *http.Request) {
 	v.CheckNotBlank(requestPayload.Title, "title", "must be provided")
 	v.CheckNotBlank(requestPayload.Description, "description", "must be provided")
 	v.CheckNotBlank(requestPayload.Body, "body", "must be provided")
+	if requestPayload.CoverImage != nil {
+		checkImageURL(v, "coverImage", strings.TrimSpace(*requestPayload.CoverImage))
+	}
 
 	if !v.IsValid() {
 		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
 		return
 	}
 
-	var createdTags []*models.Tag
-	if requestPayload.TagList != nil && len(*requestPayload.TagList) > 0 {
-		for _, tag := range *requestPayload.TagList {
-			v.CheckNotBlank(tag, "tag", "must be provided")
+	var tagModels []*models.Tag
+	if requestPayload.TagList != nil {
+		for _, name := range tagging.ParseList(v, *requestPayload.TagList, app.tagRules()) {
+			tagModels = append(tagModels, &models.Tag{Name: name.Canonical, DisplayName: name.Display})
 		}
 		if !v.IsValid() {
 			app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
 			return
 		}
+	}
 
-		var tagModels []*models.Tag
-		for _, tag := range *requestPayload.TagList {
-			tagModels = append(tagModels, &models.Tag{Name: strings.TrimSpace(tag)})
-		}
-
-		user, _ := app.auth.GetAuthenticatedUser(r)
-		article, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Article, error) {
-			tags, err := app.core.CreateTag(txCtx, tagModels)
-			if err != nil {
-				switch {
-				case errors.Is(err, core.ErrDuplicatedSlug):
-					app.internalErrorResponse(w, r, err)
-					return nil, err
-				default:
-					app.internalErrorResponse(w, r, err)
-					return nil, err
-				}
-			}
-			createdTags = tags
-			slug := app.core.CreateSlug(requestPayload.Title)
-
-			return app.core.CreateArticle(txCtx, &models.Article{
-				Title:       requestPayload.Title,
-				Description: requestPayload.Description,
-				Body:        requestPayload.Body,
-				Slug:        slug,
-				AuthorID:    user.ID,
-			}, createdTags)
-		})
-
-		if err != nil {
-			switch {
-			case errors.Is(err, core.ErrDuplicatedSlug):
-				v.AddError("slug", "Slug already exists")
-				app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors, ErrorStack: err})
-				return
-			default:
-				app.internalErrorResponse(w, r, err)
-				return
-			}
-		}
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Article, error) {
+		slug := app.core.CreateSlug(requestPayload.Title)
+
+		return app.core.CreateArticle(txCtx, &models.Article{
+			Title:       requestPayload.Title,
+			Description: requestPayload.Description,
+			Body:        requestPayload.Body,
+			Slug:        slug,
+			AuthorID:    user.ID,
+			CoverImage:  coverImage(requestPayload.CoverImage),
+		}, tagModels)
+	})
 
-		response, err := prepareSingleArticleResponse(r, article, app, user)
-		if err != nil {
+	if err != nil {
+		switch {
+		case errors.Is(err, core.ErrDuplicatedSlug):
+			v.AddError("slug", "Slug already exists")
+			app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors, ErrorStack: err})
+			return
+		default:
 			app.internalErrorResponse(w, r, err)
 			return
 		}
+	}
 
-		if err := app.writeJSON(w, http.StatusAccepted, response, nil); err != nil {
-			app.internalErrorResponse(w, r, err)
-		}
+	response, err := prepareSingleArticleResponse(r, article, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusAccepted, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
 	}
 }
 
@@ -121,6 +111,7 @@ func (app *application) updateArticle(w http.ResponseWriter, r *http.Request) {
 		Title       *string `json:"title"`
 		Description *string `json:"description"`
 		Body        *string `json:"body"`
+		CoverImage  *string `json:"coverImage"`
 	}
 
 	type UpdateArticleRequest struct {
@@ -144,7 +135,12 @@ func (app *application) updateArticle(w http.ResponseWriter, r *http.Request) {
 	articleBySlug, err := app.core.GetArticleBySlug(r.Context(), slug)
 
 	if err != nil {
-		app.internalErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -153,6 +149,17 @@ func (app *application) updateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	coAuthorIdsByArticleId, err := app.core.CoAuthorIdsByArticleId(r.Context(), []int64{articleBySlug.ID})
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.auth.CheckUserCanChangeArticle(authenticatedUser, articleBySlug.AuthorID, coAuthorIdsByArticleId[articleBySlug.ID]); err != nil {
+		app.notPermittedResponse(w, r, err)
+		return
+	}
+
 	if updateArticleRequest.Title != nil {
 		trimSpace := strings.TrimSpace(*updateArticleRequest.Title)
 		articleBySlug.Title = trimSpace
@@ -166,8 +173,19 @@ func (app *application) updateArticle(w http.ResponseWriter, r *http.Request) {
 		trimSpace := strings.TrimSpace(*updateArticleRequest.Body)
 		articleBySlug.Body = trimSpace
 	}
+	if updateArticleRequest.CoverImage != nil {
+		v := validator.New()
+		checkImageURL(v, "coverImage", strings.TrimSpace(*updateArticleRequest.CoverImage))
+		if !v.IsValid() {
+			app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+			return
+		}
+		articleBySlug.CoverImage = coverImage(updateArticleRequest.CoverImage)
+	}
 
-	article, err := app.core.UpdateArticle(r.Context(), articleBySlug)
+	article, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Article, error) {
+		return app.core.UpdateArticle(txCtx, articleBySlug, authenticatedUser)
+	})
 
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
@@ -186,6 +204,41 @@ func (app *application) updateArticle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) deleteArticle(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := strings.TrimSpace(params.ByName("slug"))
+	user, _ := app.auth.GetAuthenticatedUser(r)
+
+	err := app.session.DoTransactionally(r.Context(), func(txCtx context.Context) error {
+		article, err := app.core.GetArticleBySlug(txCtx, slug)
+		if err != nil {
+			return err
+		}
+
+		if err := app.auth.CheckUserCanDeleteArticle(user, article.AuthorID); err != nil {
+			return err
+		}
+
+		return app.core.DeleteArticle(txCtx, article)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, auth.NotAuthorizeToDeleteArticle):
+			app.notPermittedResponse(w, r, err)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) getArticles(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
 	query := r.URL.Query()
@@ -204,13 +257,18 @@ func (app *application) getArticles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	articles, err := app.core.GetArticles(r.Context(), filters, tagQ, authorQ, favoritedQ)
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	articles, err := app.core.GetArticles(r.Context(), filters, core.ArticleCriteria{
+		Tag:            tagQ,
+		AuthorUserName: authorQ,
+		FavoritedBy:    favoritedQ,
+		Viewer:         user,
+	})
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
 		return
 	}
 
-	user, _ := app.auth.GetAuthenticatedUser(r)
 	response, err := prepareMultiArticleResponse(r, articles, app, user)
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
@@ -224,37 +282,41 @@ func (app *application) getArticles(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (app *application) favouriteArticle(w http.ResponseWriter, r *http.Request) {
-	params := httprouter.ParamsFromContext(r.Context())
-	slug := params.ByName("slug")
-
+// getPersonalFeed serves GET /api/articles/feed: the articles of the authors and tags the user follows,
+// the newest first, each with the reason it is in the feed.
+func (app *application) getPersonalFeed(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
-	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
 
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
 	if !v.IsValid() {
 		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
 		return
 	}
 
 	user, _ := app.auth.GetAuthenticatedUser(r)
-	articleBySlug, err := app.core.GetArticleBySlug(r.Context(), slug)
+	articles, err := app.core.GetArticles(r.Context(), filters, core.ArticleCriteria{
+		FollowedBy:       user,
+		WithFollowedTags: true,
+		Viewer:           user,
+	})
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
 		return
 	}
 
-	if articleBySlug == nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-
-	favouriteArticle, err := app.core.FavoriteArticle(r.Context(), slug, user)
+	reasons, err := app.core.GetFeedReasons(r.Context(), user, functional.Map(articles, func(a *models.Article) int64 {
+		return a.ID
+	}))
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
 		return
 	}
 
-	response, err := prepareSingleArticleResponse(r, favouriteArticle, app, user)
+	response, err := prepareFeedArticleResponse(r, articles, app, user, reasons)
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
 		return
@@ -262,13 +324,13 @@ func (app *application) favouriteArticle(w http.ResponseWriter, r *http.Request)
 
 	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
 		app.internalErrorResponse(w, r, err)
-		return
 	}
 }
 
-func (app *application) unfavouriteArticle(w http.ResponseWriter, r *http.Request) {
+func (app *application) getArticle(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
-	slug := params.ByName("slug")
+	slug := strings.TrimSpace(params.ByName("slug"))
+
 	v := validator.New()
 	v.CheckNotBlank(slug, "slug", "slug must be provided")
 	if !v.IsValid() {
@@ -276,21 +338,66 @@ func (app *application) unfavouriteArticle(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// fixed paths under /api/articles can't have routes of their own next to the slug
+	switch slug {
+	case core.TrendingSlug:
+		app.getTrendingArticles(w, r)
+		return
+	case core.FeedSlug:
+		app.requireAuthenticatedUser(app.getPersonalFeed)(w, r)
+		return
+	}
+
 	user, _ := app.auth.GetAuthenticatedUser(r)
-	articleBySlug, err := app.core.GetArticleBySlug(r.Context(), slug)
+	article, err := app.core.GetArticleBySlugForViewer(r.Context(), slug, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.recordView(r, article, user)
+
+	response, err := prepareSingleArticleResponse(r, article, app, user)
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
 		return
 	}
 
-	if articleBySlug == nil {
-		app.notFoundResponse(w, r)
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) favouriteArticle(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
 		return
 	}
 
-	favouriteArticle, err := app.core.UnFavoriteArticle(r.Context(), slug, user)
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	favouriteArticle, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Article, error) {
+		return app.core.FavoriteArticle(txCtx, slug, user)
+	})
 	if err != nil {
-		app.internalErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, core.ErrBlockedByUser):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -306,34 +413,83 @@ func (app *application) unfavouriteArticle(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (app *application) getTagList(w http.ResponseWriter, r *http.Request) {
-	tags, err := app.core.GetTagsList(r.Context())
-	if err != nil {
-		app.internalErrorResponse(w, r, err)
+func (app *application) unfavouriteArticle(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
 		return
 	}
 
-	tagNames := functional.Map(tags, func(t *models.Tag) string {
-		return t.Name
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	_, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Article, error) {
+		return app.core.UnFavoriteArticle(txCtx, slug, user)
 	})
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the favorite is removed even if the user can no longer see the article, which is then not shown
+	favouriteArticle, err := app.core.GetArticleBySlugForViewer(r.Context(), slug, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response, err := prepareSingleArticleResponse(r, favouriteArticle, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
 
-	if err := app.writeJSON(w, http.StatusOK, envelope{
-		"tags": tagNames,
-	}, nil); err != nil {
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
 		app.internalErrorResponse(w, r, err)
 		return
 	}
 }
 
+// coverImage trims the cover image url of a request, an empty one removes the cover image.
+func coverImage(rawURL *string) *string {
+	if rawURL == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*rawURL)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
 func prepareMultiArticleResponse(r *http.Request, articles []*models.Article, app *application, currentLoginUser *auth.User) (envelope, error) {
-	return prepareArticleResponse(r, articles, app, currentLoginUser, false)
+	return prepareArticleResponse(r, articles, app, currentLoginUser, false, nil)
+}
+
+// prepareFeedArticleResponse is the multi article response of the personal feed, which tells for each
+// article why it is in the feed.
+func prepareFeedArticleResponse(r *http.Request, articles []*models.Article, app *application, currentLoginUser *auth.User,
+	reasons map[int64]*models.FeedReason) (envelope, error) {
+	return prepareArticleResponse(r, articles, app, currentLoginUser, false, reasons)
 }
 
 func prepareSingleArticleResponse(r *http.Request, article *models.Article, app *application, currentLoginUser *auth.User) (envelope, error) {
-	return prepareArticleResponse(r, []*models.Article{article}, app, currentLoginUser, true)
+	return prepareArticleResponse(r, []*models.Article{article}, app, currentLoginUser, true, nil)
 }
 
-func prepareArticleResponse(r *http.Request, articles []*models.Article, app *application, currentLoginUser *auth.User, singleResponse bool) (envelope, error) {
+func prepareArticleResponse(r *http.Request, articles []*models.Article, app *application, currentLoginUser *auth.User, singleResponse bool,
+	reasons map[int64]*models.FeedReason) (envelope, error) {
 	type AuthorEnvelop struct {
 		Username  string  `json:"username"`
 		Bio       *string `json:"bio"`
@@ -342,16 +498,27 @@ func prepareArticleResponse(r *http.Request, articles []*models.Article, app *ap
 	}
 
 	type ArticleEnvelope struct {
-		Slug           string        `json:"slug"`
-		Title          string        `json:"title"`
-		Description    string        `json:"description"`
-		Body           *string       `json:"body,omitempty"`
-		TagList        []string      `json:"tagList"`
-		CreatedAt      time.Time     `json:"createdAt"`
-		UpdatedAt      time.Time     `json:"updatedAt"`
-		Favorited      bool          `json:"favorited"`
-		FavoritesCount int64         `json:"favoritesCount"`
-		Author         AuthorEnvelop `json:"author"`
+		Slug               string                 `json:"slug"`
+		Title              string                 `json:"title"`
+		Description        string                 `json:"description"`
+		Body               *string                `json:"body,omitempty"`
+		BodyHTML           *string                `json:"bodyHtml,omitempty"`
+		TOC                []markdown.Heading     `json:"toc,omitempty"`
+		Excerpt            string                 `json:"excerpt"`
+		WordCount          int                    `json:"wordCount"`
+		ReadingTimeMinutes int                    `json:"readingTimeMinutes"`
+		CoverImage         *string                `json:"coverImage"`
+		TagList            []string               `json:"tagList"`
+		CreatedAt          time.Time              `json:"createdAt"`
+		UpdatedAt          time.Time              `json:"updatedAt"`
+		Favorited          bool                   `json:"favorited"`
+		FavoritesCount     int64                  `json:"favoritesCount"`
+		Bookmarked         bool                   `json:"bookmarked"`
+		Reactions          []models.ReactionCount `json:"reactions"`
+		Author             AuthorEnvelop          `json:"author"`
+		Authors            []AuthorEnvelop        `json:"authors"`
+		Reason             *models.FeedReason     `json:"reason,omitempty"`
+		Series             *models.SeriesPart     `json:"series,omitempty"`
 	}
 
 	articlesIdList := functional.Map(articles, func(a *models.Article) int64 {
@@ -368,9 +535,27 @@ func prepareArticleResponse(r *http.Request, articles []*models.Article, app *ap
 		return nil, xerrors.New(err)
 	}
 	favouriteCountByArticleId, err := app.core.FavouriteCountByArticleId(r.Context(), articlesIdList)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	bookmarkedArticleByArticleId, err := app.core.BookmarkedArticleByArticleId(r.Context(), articlesIdList, currentLoginUser)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	reactionsByArticleId, err := app.core.ArticleReactionsByArticleId(r.Context(), articlesIdList, currentLoginUser)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	coAuthorIdsByArticleId, err := app.core.CoAuthorIdsByArticleId(r.Context(), articlesIdList)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
 	userIdList := functional.Map(articles, func(article *models.Article) int64 {
 		return article.AuthorID
 	})
+	for _, coAuthorIds := range coAuthorIdsByArticleId {
+		userIdList = append(userIdList, coAuthorIds...)
+	}
 	listOfUser, err := app.core.GetUsersByIdList(r.Context(), userIdList)
 	if err != nil {
 		return nil, xerrors.New(err)
@@ -392,31 +577,59 @@ func prepareArticleResponse(r *http.Request, articles []*models.Article, app *ap
 		return user.ID, true
 	})
 
+	authorEnvelop := func(userId int64) AuthorEnvelop {
+		return AuthorEnvelop{
+			Username:  userByUserId[userId].Username,
+			Bio:       userByUserId[userId].Bio,
+			Image:     userByUserId[userId].Image,
+			Following: collectionutils.GetOrDefault(followingUserById, userId, false),
+		}
+	}
+
 	articlesEnvelop := []ArticleEnvelope{}
 	for _, article := range articles {
+		// the author comes first, then the co-authors
+		authors := []AuthorEnvelop{authorEnvelop(article.AuthorID)}
+		for _, coAuthorId := range coAuthorIdsByArticleId[article.ID] {
+			authors = append(authors, authorEnvelop(coAuthorId))
+		}
+
 		tagsList := collectionutils.GetOrDefault(tagsByArticleId, article.ID, []models.Tag{})
-		tagNameList := functional.Map(tagsList, func(t models.Tag) string { return t.Name })
+		tagNameList := functional.Map(tagsList, func(t models.Tag) string { return t.DisplayName })
 		isFavorited := favouriteArticleByArticleId[article.ID]
 		favoritesCount := favouriteCountByArticleId[article.ID]
 		articleEnvelope := ArticleEnvelope{
-			Slug:           article.Slug,
-			Title:          article.Title,
-			Description:    article.Description,
-			TagList:        tagNameList,
-			CreatedAt:      article.CreatedAt,
-			UpdatedAt:      article.UpdatedAt,
-			Favorited:      isFavorited,
-			FavoritesCount: favoritesCount,
-			Author: AuthorEnvelop{
-				Username:  userByUserId[article.AuthorID].Username,
-				Bio:       userByUserId[article.AuthorID].Bio,
-				Image:     userByUserId[article.AuthorID].Image,
-				Following: collectionutils.GetOrDefault(followingUserById, article.AuthorID, false),
-			},
+			Slug:               article.Slug,
+			Title:              article.Title,
+			Description:        article.Description,
+			Excerpt:            article.Excerpt,
+			WordCount:          article.WordCount,
+			ReadingTimeMinutes: article.ReadingTimeMinutes,
+			CoverImage:         article.CoverImage,
+			TagList:            tagNameList,
+			CreatedAt:          article.CreatedAt,
+			UpdatedAt:          article.UpdatedAt,
+			Favorited:          isFavorited,
+			FavoritesCount:     favoritesCount,
+			Bookmarked:         bookmarkedArticleByArticleId[article.ID],
+			Reactions:          app.orderReactions(reactionsByArticleId[article.ID]),
+			Author:             authors[0],
+			Authors:            authors,
+			Reason:             reasons[article.ID],
 		}
 
 		if singleResponse {
+			document, err := app.renderArticle(article)
+			if err != nil {
+				return nil, err
+			}
 			articleEnvelope.Body = &article.Body
+			articleEnvelope.BodyHTML = &document.HTML
+			articleEnvelope.TOC = document.TOC
+
+			if articleEnvelope.Series, err = app.core.GetSeriesPart(r.Context(), article.ID); err != nil {
+				return nil, err
+			}
 		}
 		articlesEnvelop = append(articlesEnvelop, articleEnvelope)
 	}
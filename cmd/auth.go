@@ -60,6 +60,7 @@ func (app *application) login(w http.ResponseWriter, r *http.Request) {
 	match, err := user.IsPasswordMatch(loginUserRequest.Password)
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
+		return
 	}
 	if !match {
 		app.badRequestResponse(w, r, &AppError{
@@ -68,6 +69,24 @@ func (app *application) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// logging in during the grace period cancels a pending account deletion
+	if user.DeletedAt != nil {
+		if err := app.core.RestoreAccount(r.Context(), user.ID); err != nil {
+			switch {
+			case errors.Is(err, core.ErrAccountNotDeleted):
+				app.badRequestResponse(w, r, &AppError{
+					ErrorMessage: "Invalid credentials",
+					ErrorStack:   err,
+				})
+			default:
+				app.internalErrorResponse(w, r, err)
+			}
+			return
+		}
+		user.DeletedAt = nil
+		app.auth.InvalidateCachedUser(user.ID)
+	}
+
 	token, err := user.GenerateToken(time.Hour*24*1, app.config.JWTSecret)
 	user.Token = token
 	if err != nil {
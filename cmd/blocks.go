@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+type profileRelationAction func(ctx context.Context, user auth.User, username string) (*models.Profile, error)
+
+func (app *application) blockUser(w http.ResponseWriter, r *http.Request) {
+	app.changeProfileRelation(w, r, app.core.BlockUser)
+}
+
+func (app *application) unblockUser(w http.ResponseWriter, r *http.Request) {
+	app.changeProfileRelation(w, r, app.core.UnblockUser)
+}
+
+func (app *application) muteUser(w http.ResponseWriter, r *http.Request) {
+	app.changeProfileRelation(w, r, app.core.MuteUser)
+}
+
+func (app *application) unmuteUser(w http.ResponseWriter, r *http.Request) {
+	app.changeProfileRelation(w, r, app.core.UnmuteUser)
+}
+
+// changeProfileRelation runs a block/mute action of the authenticated user against the profile in the URL.
+func (app *application) changeProfileRelation(w http.ResponseWriter, r *http.Request, action profileRelationAction) {
+	params := httprouter.ParamsFromContext(r.Context())
+	authenticatedUser, _ := app.auth.GetAuthenticatedUser(r)
+
+	username := strings.TrimSpace(params.ByName("followee"))
+	v := validator.New()
+	v.CheckNotBlank(username, "username", "must be provided")
+
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	profile, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Profile, error) {
+		return action(txCtx, *authenticatedUser, username)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, core.ErrCannotBlockYourself),
+			errors.Is(err, core.UserIsNotBlocked),
+			errors.Is(err, core.UserIsNotMuted):
+			app.badRequestResponse(w, r, &AppError{
+				ErrorMessage: err.Error(),
+				ErrorStack:   err,
+			})
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+func (app *application) bookmarkArticle(w http.ResponseWriter, r *http.Request) {
+	app.changeBookmark(w, r, app.core.BookmarkArticle)
+}
+
+func (app *application) unbookmarkArticle(w http.ResponseWriter, r *http.Request) {
+	app.changeBookmark(w, r, app.core.UnbookmarkArticle)
+}
+
+// changeBookmark adds or removes a bookmark of the article of the slug and responds with the article.
+func (app *application) changeBookmark(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, slug string, user *auth.User) (*models.Article, error)) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := change(r.Context(), slug, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response, err := prepareSingleArticleResponse(r, article, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// getBookmarks serves GET /api/user/bookmarks, the reading list of the authenticated user.
+func (app *application) getBookmarks(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	articles, err := app.core.GetBookmarkedArticles(r.Context(), filters, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := prepareMultiArticleResponse(r, articles, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+// inviteCoAuthor serves POST /api/articles/:slug/authors with a body of {"username": "..."}. Only the author
+// of the article can invite co-authors.
+func (app *application) inviteCoAuthor(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := app.readJSON(w, r, &request); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	username := strings.TrimSpace(request.Username)
+	v := validator.New()
+	v.CheckNotBlank(username, "username", "must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := app.changeCoAuthors(r, user, func(txCtx context.Context, article *models.Article) error {
+		if err := app.auth.CheckUserCanChangeAuthors(user, article.AuthorID); err != nil {
+			return err
+		}
+		return app.core.InviteCoAuthor(txCtx, article, username)
+	})
+	if err != nil {
+		app.coAuthorErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCoAuthorResponse(w, r, article, user)
+}
+
+// removeCoAuthor serves DELETE /api/articles/:slug/authors/:username. The author of the article can remove
+// any co-author or withdraw an invitation, a co-author can only remove themselves.
+func (app *application) removeCoAuthor(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	username := strings.TrimSpace(params.ByName("username"))
+
+	v := validator.New()
+	v.CheckNotBlank(username, "username", "must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := app.changeCoAuthors(r, user, func(txCtx context.Context, article *models.Article) error {
+		if user.Username != username {
+			if err := app.auth.CheckUserCanChangeAuthors(user, article.AuthorID); err != nil {
+				return err
+			}
+		}
+		return app.core.RemoveCoAuthor(txCtx, article, username)
+	})
+	if err != nil {
+		app.coAuthorErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCoAuthorResponse(w, r, article, user)
+}
+
+// getCoAuthorInvitations serves GET /api/user/coauthor-invitations, the articles the authenticated user is
+// invited to co-author.
+func (app *application) getCoAuthorInvitations(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	articles, err := app.core.GetCoAuthorInvitations(r.Context(), user, filters)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := prepareMultiArticleResponse(r, articles, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptCoAuthorInvitation(w http.ResponseWriter, r *http.Request) {
+	app.answerCoAuthorInvitation(w, r, app.core.AcceptCoAuthorInvitation)
+}
+
+func (app *application) declineCoAuthorInvitation(w http.ResponseWriter, r *http.Request) {
+	app.answerCoAuthorInvitation(w, r, app.core.DeclineCoAuthorInvitation)
+}
+
+func (app *application) answerCoAuthorInvitation(w http.ResponseWriter, r *http.Request,
+	answer func(ctx context.Context, slug string, user *auth.User) (*models.Article, error)) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := strings.TrimSpace(params.ByName("slug"))
+
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := answer(r.Context(), slug, user)
+	if err != nil {
+		app.coAuthorErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCoAuthorResponse(w, r, article, user)
+}
+
+// changeCoAuthors runs change on the article of the slug inside a transaction.
+func (app *application) changeCoAuthors(r *http.Request, user *auth.User,
+	change func(txCtx context.Context, article *models.Article) error) (*models.Article, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	return databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Article, error) {
+		article, err := app.core.GetArticleBySlug(txCtx, strings.TrimSpace(params.ByName("slug")))
+		if err != nil {
+			return nil, err
+		}
+		return article, change(txCtx, article)
+	})
+}
+
+func (app *application) writeCoAuthorResponse(w http.ResponseWriter, r *http.Request, article *models.Article, user *auth.User) {
+	response, err := prepareSingleArticleResponse(r, article, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) coAuthorErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, core.NoRecordFound), errors.Is(err, core.CoAuthorInvitationNotFound),
+		errors.Is(err, core.ErrNotCoAuthor):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, auth.NotAuthorizeToChangeAuthors):
+		app.notPermittedResponse(w, r, err)
+	case errors.Is(err, core.ErrBlockedByUser):
+		app.forbiddenResponse(w, r, err)
+	case errors.Is(err, core.ErrCoAuthorIsAuthor), errors.Is(err, core.ErrAlreadyCoAuthor):
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+	default:
+		app.internalErrorResponse(w, r, err)
+	}
+}
@@ -9,18 +9,22 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
 	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/functional"
 	"github.com/siahsang/blog/internal/validator"
 	"github.com/siahsang/blog/models"
 )
 
 // CommentResponse struct
 type CommentResponse struct {
-	ID        int64              `json:"id"`
-	CreatedAt time.Time          `json:"createdAt"`
-	UpdatedAt time.Time          `json:"updatedAt"`
-	Body      string             `json:"body"`
-	Author    *CommentAuthorBody `json:"author,omitempty"`
+	ID        int64                  `json:"id"`
+	CreatedAt time.Time              `json:"createdAt"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+	Body      string                 `json:"body"`
+	BodyHTML  *string                `json:"bodyHtml,omitempty"`
+	Reactions []models.ReactionCount `json:"reactions"`
+	Author    *CommentAuthorBody     `json:"author,omitempty"`
 }
 
 // CommentAuthorBody struct
@@ -51,7 +55,7 @@ func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	v := validator.New()
-	v.CheckNotBlank(createCommentRequest.Body, "body", "must be provided")
+	validateComment(v, createCommentRequest.Body)
 
 	if !v.IsValid() {
 		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
@@ -62,14 +66,41 @@ func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
 	slug := params.ByName("slug")
 
 	user, _ := app.auth.GetAuthenticatedUser(r)
-	newComment, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Comment, error) {
+	newComment, err := app.postComment(r.Context(), user, slug, createCommentRequest.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, core.ErrBlockedByUser):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response, err := prepareSingleCommentsResponse(app, r, newComment, user)
+	err = app.writeJSON(w, http.StatusCreated, response, nil)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func validateComment(v *validator.Validator, body string) {
+	v.CheckNotBlank(body, "body", "must be provided")
+}
+
+// postComment creates the comment of the user on the article. It is shared by the HTTP and the live
+// comment endpoints so both apply the same rules.
+func (app *application) postComment(ctx context.Context, user *auth.User, slug string, body string) (*models.Comment, error) {
+	return databaseutils.DoTransactionally(ctx, app.session, func(txCtx context.Context) (*models.Comment, error) {
 		articleBySlug, err := app.core.GetArticleBySlug(txCtx, slug)
 		if err != nil {
 			return nil, err
 		}
 
 		comment, err := app.core.CreateComment(txCtx, &models.Comment{
-			Body:      createCommentRequest.Body,
+			Body:      body,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 			ArticleID: articleBySlug.ID,
@@ -81,17 +112,6 @@ func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
 
 		return comment, nil
 	})
-
-	if err != nil {
-		app.internalErrorResponse(w, r, err)
-		return
-	}
-
-	response, err := prepareSingleCommentsResponse(app, r, newComment, user)
-	err = app.writeJSON(w, http.StatusCreated, response, nil)
-	if err != nil {
-		app.internalErrorResponse(w, r, err)
-	}
 }
 
 func (app *application) getComments(w http.ResponseWriter, r *http.Request) {
@@ -106,14 +126,18 @@ func (app *application) getComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commentsBySlug, err := app.core.GetCommentsBySlug(r.Context(), slug)
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	commentsBySlug, err := app.core.GetCommentsBySlug(r.Context(), slug, user)
 	if err != nil {
-		app.internalErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	user, _ := app.auth.GetAuthenticatedUser(r)
-
 	response, err := prepareMultiCommentsResponse(app, r, commentsBySlug, user)
 	if err != nil {
 		app.internalErrorResponse(w, r, err)
@@ -193,17 +217,29 @@ func prepareMultiCommentsResponse(app *application, r *http.Request, comments []
 func prepareCommentsResponse(app *application, r *http.Request, comments []*models.Comment, loginUser *auth.User, singComment bool) (envelope, error) {
 	var response []CommentResponse
 
+	commentIdList := functional.Map(comments, func(comment *models.Comment) int64 {
+		return comment.ID
+	})
+	reactionsByCommentId, err := app.core.CommentReactionsByCommentId(r.Context(), commentIdList, loginUser)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, comment := range comments {
 		commentResponse := CommentResponse{}
-		profile, err := app.core.GetProfileByUserId(r.Context(), comment.AuthorID)
+		profile, err := app.core.GetProfileByUserId(r.Context(), comment.AuthorID, loginUser)
 		if err != nil {
 			return nil, err
 		}
 
 		commentResponse.ID = comment.ID
 		commentResponse.Body = comment.Body
+		if commentResponse.BodyHTML, err = app.renderComment(comment); err != nil {
+			return nil, err
+		}
 		commentResponse.CreatedAt = comment.CreatedAt
 		commentResponse.UpdatedAt = comment.UpdatedAt
+		commentResponse.Reactions = app.orderReactions(reactionsByCommentId[comment.ID])
 
 		if loginUser != nil {
 			commentResponse.Author = &CommentAuthorBody{}
@@ -51,6 +51,27 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	})
 }
 
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusForbidden, nil, &AppError{
+		ErrorStack:   err,
+		ErrorMessage: err.Error(),
+	})
+}
+
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, nil, &AppError{
+		ErrorStack:   err,
+		ErrorMessage: err.Error(),
+	})
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, nil, &AppError{
+		ErrorStack:   err,
+		ErrorMessage: err.Error(),
+	})
+}
+
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, headers http.Header, appError *AppError) {
 	errorDetails := map[string]any{}
 
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/feeds"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/collectionutils"
+	"github.com/siahsang/blog/internal/utils/functional"
+	"github.com/siahsang/blog/models"
+)
+
+// Feed formats, picked by the extension of the last path segment
+const (
+	atomFormat = "atom"
+	rssFormat  = "rss"
+)
+
+// feedSize is how many of the latest articles a feed holds.
+const feedSize = 20
+
+func (app *application) getArticlesAtomFeed(w http.ResponseWriter, r *http.Request) {
+	app.serveArticleFeed(w, r, atomFormat, "Latest articles", app.config.SiteURL, core.ArticleCriteria{})
+}
+
+func (app *application) getArticlesRSSFeed(w http.ResponseWriter, r *http.Request) {
+	app.serveArticleFeed(w, r, rssFormat, "Latest articles", app.config.SiteURL, core.ArticleCriteria{})
+}
+
+func (app *application) getTagFeed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	tag, format := splitFeedFormat(params.ByName("tag"))
+	if tag == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.serveArticleFeed(w, r, format, fmt.Sprintf("Articles tagged %s", tag),
+		app.config.SiteURL+"/tag/"+url.PathEscape(tag), core.ArticleCriteria{Tag: tag})
+}
+
+func (app *application) getProfileFeed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	username, format := splitFeedFormat(params.ByName("username"))
+
+	if _, err := app.core.GetUserByUsername(r.Context(), username); err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.serveArticleFeed(w, r, format, fmt.Sprintf("Articles by %s", username),
+		app.config.SiteURL+"/profile/"+url.PathEscape(username), core.ArticleCriteria{AuthorUserName: username})
+}
+
+// getPrivateFeed serves the articles of the authors a user follows. Feed readers can't log in, so the
+// user is identified by the secret token in the url instead.
+func (app *application) getPrivateFeed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	token, format := splitFeedFormat(params.ByName("token"))
+
+	user, err := app.core.GetUserByFeedToken(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private")
+	app.serveArticleFeed(w, r, format, fmt.Sprintf("Articles followed by %s", user.Username),
+		app.config.SiteURL, core.ArticleCriteria{FollowedBy: user, Viewer: user})
+}
+
+// getFeedURLs returns the urls of the authenticated user's private feed.
+func (app *application) getFeedURLs(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	token, err := app.core.GetFeedToken(r.Context(), user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, privateFeedResponse(r, token), nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// resetFeedURLs replaces the token of the private feed, e.g. after its url leaked.
+func (app *application) resetFeedURLs(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	token, err := app.core.ResetFeedToken(r.Context(), user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, privateFeedResponse(r, token), nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func privateFeedResponse(r *http.Request, token string) envelope {
+	base := requestBaseURL(r) + "/feeds/private/" + token
+	return envelope{"feeds": envelope{atomFormat: base + ".atom", rssFormat: base + ".rss"}}
+}
+
+func (app *application) serveArticleFeed(w http.ResponseWriter, r *http.Request, format, title, link string, criteria core.ArticleCriteria) {
+	articles, err := app.core.GetArticles(r.Context(), filter.NewFilter(feedSize, 0), criteria)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	feed, err := app.articleFeed(r, title, link, articles)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	etag := feed.ETag(format)
+	lastModified := feed.Updated().UTC().Truncate(time.Second)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var (
+		body        []byte
+		contentType string
+	)
+	switch format {
+	case rssFormat:
+		body, err = feed.RSS()
+		contentType = feeds.RSSContentType
+	default:
+		body, err = feed.Atom()
+		contentType = feeds.AtomContentType
+	}
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func (app *application) articleFeed(r *http.Request, title, link string, articles []*models.Article) (*feeds.Feed, error) {
+	articleIdList := functional.Map(articles, func(article *models.Article) int64 { return article.ID })
+	tagsByArticleId, err := app.core.GetTagsByArticleId(r.Context(), articleIdList)
+	if err != nil {
+		return nil, err
+	}
+
+	authors, err := app.core.GetUsersByIdList(r.Context(), functional.Map(articles, func(article *models.Article) int64 {
+		return article.AuthorID
+	}))
+	if err != nil {
+		return nil, err
+	}
+	authorById := collectionutils.Associate(authors, func(user *auth.User) (int64, *auth.User) {
+		return user.ID, user
+	})
+
+	feed := &feeds.Feed{
+		Title:    title,
+		Link:     link,
+		SelfLink: requestBaseURL(r) + r.URL.Path,
+	}
+	for _, article := range articles {
+		document, err := app.renderArticle(article)
+		if err != nil {
+			return nil, err
+		}
+
+		item := feeds.Item{
+			ID:          fmt.Sprintf("urn:blog:article:%d", article.ID),
+			Title:       article.Title,
+			Link:        app.config.SiteURL + "/article/" + article.Slug,
+			Summary:     cmp.Or(article.Description, article.Excerpt),
+			ContentHTML: document.HTML,
+			Published:   article.CreatedAt,
+			Updated:     article.UpdatedAt,
+		}
+		if author, ok := authorById[article.AuthorID]; ok {
+			item.Author = author.Username
+		}
+		for _, tag := range collectionutils.GetOrDefault(tagsByArticleId, article.ID, []models.Tag{}) {
+			item.Categories = append(item.Categories, tag.DisplayName)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
+
+// notModified reports whether the client's cached copy, identified by If-None-Match or If-Modified-Since, is current.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		// If-Modified-Since is ignored when If-None-Match is sent
+		return false
+	}
+
+	if ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		return !lastModified.After(ifModifiedSince)
+	}
+	return false
+}
+
+// splitFeedFormat splits "golang.rss" into "golang" and the format. Atom is the default.
+func splitFeedFormat(segment string) (string, string) {
+	if name, found := strings.CutSuffix(segment, ".rss"); found {
+		return name, rssFormat
+	}
+	return strings.TrimSuffix(segment, ".atom"), atomFormat
+}
+
+// requestBaseURL is the scheme and host the client used to reach the api.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -1,7 +1,11 @@
 package main
 
-import "net/http"
-import "github.com/julienschmidt/httprouter"
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
 
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
@@ -12,21 +16,93 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/api/users", app.createUser)
 	router.HandlerFunc(http.MethodPost, "/api/users/login", app.login)
 	router.GET("/api/profiles/:username", app.getProfile)
+	router.HandlerFunc(http.MethodGet, "/api/profiles/:username/followers", app.getFollowers)
+	router.HandlerFunc(http.MethodGet, "/api/profiles/:username/following", app.getFollowing)
 	router.HandlerFunc(http.MethodGet, "/api/articles", app.getArticles)
+	router.HandlerFunc(http.MethodGet, "/api/articles/:slug", app.getArticle)
+	router.HandlerFunc(http.MethodGet, "/api/articles/:slug/related", app.getRelatedArticles)
 	router.HandlerFunc(http.MethodGet, "/api/articles/:slug/comments", app.getComments)
+	router.HandlerFunc(http.MethodGet, "/api/articles/:slug/live", app.liveComments)
 	router.HandlerFunc(http.MethodGet, "/api/tags", app.getTagList)
+	router.HandlerFunc(http.MethodGet, "/api/series", app.getSeriesList)
+	router.HandlerFunc(http.MethodGet, "/api/series/:slug", app.getSeries)
+	router.HandlerFunc(http.MethodGet, "/api/tags/:tag", app.getTrendingTagsRoute)
+	router.HandlerFunc(http.MethodGet, "/api/stream", app.stream)
+	router.HandlerFunc(http.MethodGet, "/feeds/articles.atom", app.getArticlesAtomFeed)
+	router.HandlerFunc(http.MethodGet, "/feeds/articles.rss", app.getArticlesRSSFeed)
+	router.HandlerFunc(http.MethodGet, "/feeds/tags/:tag", app.getTagFeed)
+	router.HandlerFunc(http.MethodGet, "/feeds/profiles/:username", app.getProfileFeed)
+	router.HandlerFunc(http.MethodGet, "/feeds/private/:token", app.getPrivateFeed)
+	router.HandlerFunc(http.MethodGet, "/uploads/*key", app.serveUpload)
 
 	// Require authentication for these routes
 	router.HandlerFunc(http.MethodPut, "/api/user", app.requireAuthenticatedUser(app.updateUser))
 	router.HandlerFunc(http.MethodGet, "/api/user", app.requireAuthenticatedUser(app.getUser))
+	router.HandlerFunc(http.MethodDelete, "/api/user", app.requireAuthenticatedUser(app.deleteUser))
+	router.HandlerFunc(http.MethodPost, "/api/user/image", app.requireAuthenticatedUser(app.uploadUserImage))
+	router.HandlerFunc(http.MethodPost, "/api/uploads/images", app.requireAuthenticatedUser(app.uploadImage))
+	router.HandlerFunc(http.MethodGet, "/api/user/export", app.requireAuthenticatedUser(app.exportUserData))
+	router.HandlerFunc(http.MethodGet, "/api/user/stats", app.requireAuthenticatedUser(app.getUserStats))
+	router.HandlerFunc(http.MethodGet, "/api/user/bookmarks", app.requireAuthenticatedUser(app.getBookmarks))
+	router.HandlerFunc(http.MethodGet, "/api/user/feeds", app.requireAuthenticatedUser(app.getFeedURLs))
+	router.HandlerFunc(http.MethodPost, "/api/user/feeds/reset", app.requireAuthenticatedUser(app.resetFeedURLs))
+	router.HandlerFunc(http.MethodGet, "/api/user/follow-requests", app.requireAuthenticatedUser(app.getFollowRequests))
+	router.HandlerFunc(http.MethodPost, "/api/user/follow-requests/:username", app.requireAuthenticatedUser(app.approveFollowRequest))
+	router.HandlerFunc(http.MethodDelete, "/api/user/follow-requests/:username", app.requireAuthenticatedUser(app.denyFollowRequest))
+	router.HandlerFunc(http.MethodGet, "/api/user/coauthor-invitations", app.requireAuthenticatedUser(app.getCoAuthorInvitations))
+	router.HandlerFunc(http.MethodPost, "/api/user/coauthor-invitations/:slug", app.requireAuthenticatedUser(app.acceptCoAuthorInvitation))
+	router.HandlerFunc(http.MethodDelete, "/api/user/coauthor-invitations/:slug", app.requireAuthenticatedUser(app.declineCoAuthorInvitation))
 	router.Handler(http.MethodPost, "/api/profiles/:followee/follow", app.requireAuthenticatedUser(app.followUser))
 	router.Handler(http.MethodDelete, "/api/profiles/:followee/follow", app.requireAuthenticatedUser(app.unfollowUser))
+	router.Handler(http.MethodPost, "/api/profiles/:followee/block", app.requireAuthenticatedUser(app.blockUser))
+	router.Handler(http.MethodDelete, "/api/profiles/:followee/block", app.requireAuthenticatedUser(app.unblockUser))
+	router.Handler(http.MethodPost, "/api/profiles/:followee/mute", app.requireAuthenticatedUser(app.muteUser))
+	router.Handler(http.MethodDelete, "/api/profiles/:followee/mute", app.requireAuthenticatedUser(app.unmuteUser))
+	router.HandlerFunc(http.MethodPost, "/api/tags/:tag/follow", app.requireAuthenticatedUser(app.followTag))
+	router.HandlerFunc(http.MethodDelete, "/api/tags/:tag/follow", app.requireAuthenticatedUser(app.unfollowTag))
 	router.Handler(http.MethodPost, "/api/articles", app.requireAuthenticatedUser(app.createArticle))
 	router.Handler(http.MethodPut, "/api/articles/:slug", app.requireAuthenticatedUser(app.updateArticle))
+	router.Handler(http.MethodDelete, "/api/articles/:slug", app.requireAuthenticatedUser(app.deleteArticle))
 	router.Handler(http.MethodPost, "/api/articles/:slug/comments", app.requireAuthenticatedUser(app.createComment))
 	router.Handler(http.MethodDelete, "/api/articles/:slug/comments/:id", app.requireAuthenticatedUser(app.deleteComment))
 	router.Handler(http.MethodPost, "/api/articles/:slug/favorite", app.requireAuthenticatedUser(app.favouriteArticle))
 	router.Handler(http.MethodDelete, "/api/articles/:slug/favorite", app.requireAuthenticatedUser(app.unfavouriteArticle))
+	router.Handler(http.MethodPost, "/api/articles/:slug/bookmark", app.requireAuthenticatedUser(app.bookmarkArticle))
+	router.Handler(http.MethodDelete, "/api/articles/:slug/bookmark", app.requireAuthenticatedUser(app.unbookmarkArticle))
+	router.Handler(http.MethodPost, "/api/articles/:slug/reactions", app.requireAuthenticatedUser(app.reactToArticle))
+	router.Handler(http.MethodDelete, "/api/articles/:slug/reactions/:reaction", app.requireAuthenticatedUser(app.unreactToArticle))
+	router.Handler(http.MethodPost, "/api/articles/:slug/comments/:id/reactions", app.requireAuthenticatedUser(app.reactToComment))
+	router.Handler(http.MethodDelete, "/api/articles/:slug/comments/:id/reactions/:reaction", app.requireAuthenticatedUser(app.unreactToComment))
+	router.Handler(http.MethodPost, "/api/series", app.requireAuthenticatedUser(app.createSeries))
+	router.Handler(http.MethodPut, "/api/series/:slug", app.requireAuthenticatedUser(app.updateSeries))
+	router.Handler(http.MethodDelete, "/api/series/:slug", app.requireAuthenticatedUser(app.deleteSeries))
+	router.Handler(http.MethodPost, "/api/series/:slug/articles", app.requireAuthenticatedUser(app.addSeriesArticle))
+	router.Handler(http.MethodPut, "/api/series/:slug/articles", app.requireAuthenticatedUser(app.reorderSeries))
+	router.Handler(http.MethodDelete, "/api/series/:slug/articles/:article", app.requireAuthenticatedUser(app.removeSeriesArticle))
+	router.Handler(http.MethodPost, "/api/articles/:slug/authors", app.requireAuthenticatedUser(app.inviteCoAuthor))
+	router.Handler(http.MethodDelete, "/api/articles/:slug/authors/:username", app.requireAuthenticatedUser(app.removeCoAuthor))
+	router.HandlerFunc(http.MethodGet, "/api/notifications", app.requireAuthenticatedUser(app.getNotifications))
+	router.HandlerFunc(http.MethodGet, "/api/notifications/unread-count", app.requireAuthenticatedUser(app.getUnreadNotificationCount))
+	router.HandlerFunc(http.MethodPost, "/api/notifications/read", app.requireAuthenticatedUser(app.markNotificationsRead))
+	router.HandlerFunc(http.MethodPost, "/api/notifications/read-all", app.requireAuthenticatedUser(app.markAllNotificationsRead))
+	router.HandlerFunc(http.MethodGet, "/api/webhooks", app.requireAuthenticatedUser(app.getWebhooks))
+	router.HandlerFunc(http.MethodPost, "/api/webhooks", app.requireAuthenticatedUser(app.createWebhook))
+	router.HandlerFunc(http.MethodGet, "/api/webhooks/:id", app.requireAuthenticatedUser(app.getWebhook))
+	router.HandlerFunc(http.MethodPut, "/api/webhooks/:id", app.requireAuthenticatedUser(app.updateWebhook))
+	router.HandlerFunc(http.MethodDelete, "/api/webhooks/:id", app.requireAuthenticatedUser(app.deleteWebhook))
+	router.HandlerFunc(http.MethodGet, "/api/webhooks/:id/deliveries", app.requireAuthenticatedUser(app.getWebhookDeliveries))
+	router.HandlerFunc(http.MethodPost, "/api/webhooks/:id/deliveries/:deliveryId/replay", app.requireAuthenticatedUser(app.replayWebhookDelivery))
+
+	// Require an admin for these routes
+	// the process metrics include the command line and internal counters, so they are for admins only
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requireAdminUser(expvar.Handler().ServeHTTP))
+	router.HandlerFunc(http.MethodGet, "/api/admin/jobs", app.requireAdminUser(app.getJobs))
+	router.HandlerFunc(http.MethodPost, "/api/admin/jobs/:id/retry", app.requireAdminUser(app.retryJob))
+	router.HandlerFunc(http.MethodGet, "/api/admin/tags/:tag", app.requireAdminUser(app.getTag))
+	router.HandlerFunc(http.MethodPut, "/api/admin/tags/:tag", app.requireAdminUser(app.updateTag))
+	router.HandlerFunc(http.MethodPost, "/api/admin/tags/:tag/aliases", app.requireAdminUser(app.createTagAlias))
+	router.HandlerFunc(http.MethodDelete, "/api/admin/tags/:tag/aliases/:alias", app.requireAdminUser(app.deleteTagAlias))
+	router.HandlerFunc(http.MethodPost, "/api/admin/tags/:tag/merge", app.requireAdminUser(app.mergeTag))
 
 	return app.recoverPanic(app.authenticate(router))
 }
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 )
 
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
@@ -113,6 +114,23 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int64, v
 	return int64Value
 }
 
+// readDate reads a day given as YYYY-MM-DD, at midnight UTC.
+func (app *application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	qValue := qs.Get(key)
+
+	if qValue == "" {
+		return defaultValue
+	}
+
+	date, err := time.Parse(time.DateOnly, qValue)
+	if err != nil {
+		v.AddError(key, fmt.Sprintf("must be a date as YYYY-MM-DD: %s", qValue))
+		return defaultValue
+	}
+
+	return date
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	qValue := qs.Get(key)
 	if qValue == "" {
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/jobs"
+	"github.com/siahsang/blog/internal/validator"
+)
+
+// Job queues
+const (
+	defaultQueue     = "default"
+	maintenanceQueue = "maintenance"
+)
+
+// Job kinds
+const (
+	purgeAccountsJob = "accounts.purge"
+	pruneOutboxJob   = "outbox.prune"
+	pruneJobsJob     = "jobs.prune"
+	pruneTagsJob     = "tags.prune"
+	refreshTrendJob  = "trending.refresh"
+)
+
+var jobStatuses = []string{jobs.StatusPending, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusDead}
+
+// registerJobs sets up the job queues, the handlers of every job kind and the recurring jobs.
+func (app *application) registerJobs() error {
+	app.jobs.AddQueue(jobs.Queue{Name: defaultQueue, Concurrency: 4, Timeout: 5 * time.Minute})
+	// maintenance jobs sweep whole tables, one at a time is enough
+	app.jobs.AddQueue(jobs.Queue{Name: maintenanceQueue, Concurrency: 1, Timeout: 30 * time.Minute})
+
+	jobs.Register(app.jobs, purgeAccountsJob, maintenanceQueue, 3, app.purgeDeletedAccounts)
+	jobs.Register(app.jobs, pruneOutboxJob, maintenanceQueue, 3, app.pruneOutbox)
+	jobs.Register(app.jobs, pruneJobsJob, maintenanceQueue, 3, app.pruneJobs)
+	jobs.Register(app.jobs, pruneTagsJob, maintenanceQueue, 3, app.pruneOrphanTags)
+	jobs.Register(app.jobs, refreshTrendJob, defaultQueue, 1, app.refreshTrending)
+
+	if err := app.jobs.Schedule(app.config.AccountPurgeSchedule, purgeAccountsJob, struct{}{}); err != nil {
+		return err
+	}
+	if err := app.jobs.Schedule("@daily", pruneOutboxJob, struct{}{}); err != nil {
+		return err
+	}
+	if err := app.jobs.Schedule("@daily", pruneJobsJob, struct{}{}); err != nil {
+		return err
+	}
+	if err := app.jobs.Schedule("@daily", pruneTagsJob, struct{}{}); err != nil {
+		return err
+	}
+	return app.jobs.Schedule(app.config.TrendingSchedule, refreshTrendJob, struct{}{})
+}
+
+// pruneJobs is the recurring job that deletes the succeeded jobs older than the retention.
+func (app *application) pruneJobs(ctx context.Context, _ struct{}) error {
+	deleted, err := app.jobs.Prune(ctx, app.config.JobRetention)
+	if err != nil {
+		return err
+	}
+	app.logger.Info("pruned jobs", "deleted", deleted)
+	return nil
+}
+
+func (app *application) getJobs(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	status := app.readString(query, "status", "")
+	v.Check(status == "" || slices.Contains(jobStatuses, status), "status", "must be one of pending, running, succeeded or dead")
+
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	result, err := app.jobs.Jobs(r.Context(), status, filters)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"jobs": result}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// retryJob gives a dead job a new round of attempts, e.g. after fixing what made it fail.
+func (app *application) retryJob(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	jobId, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: "id must be a valid integer",
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	job, err := app.jobs.Retry(r.Context(), jobId)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, jobs.ErrJobNotRetryable):
+			app.badRequestResponse(w, r, &AppError{
+				ErrorMessage: err.Error(),
+				ErrorStack:   err,
+			})
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"job": job}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/pubsub"
+	"github.com/siahsang/blog/internal/validator"
+)
+
+const (
+	liveMaxMessageSize = 16 << 10
+	liveWriteWait      = 10 * time.Second
+	livePongWait       = 60 * time.Second
+	livePingInterval   = livePongWait * 9 / 10
+	// liveTypingInterval is the minimum time between two typing indicators of a connection.
+	liveTypingInterval = 2 * time.Second
+)
+
+// Live messages
+const (
+	liveMessageComment  = "comment"
+	liveMessageTyping   = "typing"
+	liveMessagePresence = "presence"
+	liveMessageAck      = "ack"
+	liveMessageError    = "error"
+)
+
+var liveUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// liveClientMessage is what clients send: {"type":"comment","id":"1","body":"..."} or {"type":"typing"}.
+// The id is echoed in the ack or error answering the message.
+type liveClientMessage struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Body string `json:"body,omitempty"`
+}
+
+type liveServerMessage struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Data any    `json:"data,omitempty"`
+}
+
+// livePresence is what an instance publishes about the users connected to it. Clients only get the users,
+// combined across the instances.
+type livePresence struct {
+	Instance string   `json:"instance"`
+	Users    []string `json:"users"`
+}
+
+func liveTopic(slug string) string {
+	return articleTopic(slug) + "/live"
+}
+
+// liveComments is the WebSocket endpoint of an article's comment thread. Everyone who can read the
+// article receives new comments, typing indicators and the list of connected users; authenticated
+// users can also post comments.
+func (app *application) liveComments(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+	user, _ := app.auth.GetAuthenticatedUser(r)
+
+	if _, err := app.core.GetArticleBySlugForViewer(r.Context(), slug, user); err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the upgrader writes the error response itself
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// hijacked connections are invisible to Shutdown, so serve() waits for them through wg
+	app.wg.Add(1)
+	defer app.wg.Done()
+
+	subscription := app.hub.Subscribe(articleTopic(slug), liveTopic(slug))
+	defer subscription.Close()
+
+	if user != nil {
+		app.publishPresence(r.Context(), slug, app.presence.Join(liveTopic(slug), user.Username))
+		defer func() {
+			app.publishPresence(context.Background(), slug, app.presence.Leave(liveTopic(slug), user.Username))
+		}()
+	}
+
+	outgoing := make(chan liveServerMessage)
+	stopped := make(chan struct{})
+	readerDone := make(chan struct{})
+
+	go func() {
+		defer close(readerDone)
+		app.readLiveMessages(r, conn, slug, user, outgoing, stopped)
+	}()
+
+	// closing the connection unblocks the reader, which may still be posting a comment
+	defer func() {
+		close(stopped)
+		_ = conn.Close()
+		<-readerDone
+	}()
+
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-readerDone:
+			return
+		case message, ok := <-subscription.C:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"),
+					time.Now().Add(liveWriteWait))
+				return
+			}
+			if response, ok := app.prepareLiveHubMessage(r, slug, user, message); ok {
+				err = app.writeLiveMessage(conn, response)
+			}
+		case message := <-outgoing:
+			err = app.writeLiveMessage(conn, message)
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readLiveMessages handles the messages of the client until the connection fails or stopped is closed.
+func (app *application) readLiveMessages(r *http.Request, conn *websocket.Conn, slug string, user *auth.User,
+	outgoing chan<- liveServerMessage, stopped <-chan struct{}) {
+	conn.SetReadLimit(liveMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	reply := func(message liveServerMessage) bool {
+		select {
+		case outgoing <- message:
+			return true
+		case <-stopped:
+			return false
+		}
+	}
+
+	var lastTyping time.Time
+	for {
+		var message liveClientMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				if !reply(liveErrorMessage("", &AppError{ErrorMessage: "message must be valid JSON"})) {
+					return
+				}
+				continue
+			}
+			return
+		}
+
+		if user == nil {
+			if !reply(liveErrorMessage(message.ID, &AppError{ErrorMessage: "Authentication is required to access this resource."})) {
+				return
+			}
+			continue
+		}
+
+		var response liveServerMessage
+		switch message.Type {
+		case liveMessageComment:
+			response = app.postLiveComment(r, slug, user, message)
+		case liveMessageTyping:
+			if time.Since(lastTyping) < liveTypingInterval {
+				continue
+			}
+			lastTyping = time.Now()
+			if err := app.hub.Publish(r.Context(), liveTopic(slug), liveMessageTyping, envelope{"username": user.Username}); err != nil {
+				app.logger.Error("failed to publish typing indicator", "error", err.Error())
+			}
+			continue
+		default:
+			response = liveErrorMessage(message.ID, &AppError{ErrorMessage: "type must be either comment or typing"})
+		}
+
+		if !reply(response) {
+			return
+		}
+	}
+}
+
+// postLiveComment creates the comment with the same validation and authorization as createComment.
+// Every connection, this one included, receives the comment from the hub; the ack carries it as seen by the author.
+func (app *application) postLiveComment(r *http.Request, slug string, user *auth.User, message liveClientMessage) liveServerMessage {
+	v := validator.New()
+	validateComment(v, message.Body)
+	if !v.IsValid() {
+		return liveErrorMessage(message.ID, &AppError{ErrorDetails: v.Errors})
+	}
+
+	comment, err := app.postComment(r.Context(), user, slug, message.Body)
+	if err == nil {
+		var response envelope
+		response, err = prepareSingleCommentsResponse(app, r, comment, user)
+		if err == nil {
+			return liveServerMessage{Type: liveMessageAck, ID: message.ID, Data: response}
+		}
+	}
+
+	switch {
+	case errors.Is(err, core.NoRecordFound):
+		return liveErrorMessage(message.ID, &AppError{ErrorMessage: "The requested resource could not be found."})
+	case errors.Is(err, core.ErrBlockedByUser):
+		return liveErrorMessage(message.ID, &AppError{ErrorMessage: err.Error()})
+	default:
+		app.logger.Error("failed to post live comment", "slug", slug, "error", err.Error())
+		return liveErrorMessage(message.ID, &AppError{ErrorMessage: "An internal server error occurred."})
+	}
+}
+
+// prepareLiveHubMessage turns a message of the hub into the message for the client. It returns false when
+// the message isn't for the user: the comments of users they have muted or blocked are left out.
+func (app *application) prepareLiveHubMessage(r *http.Request, slug string, user *auth.User, message pubsub.Message) (liveServerMessage, bool) {
+	switch message.Event {
+	case liveMessagePresence:
+		var presence livePresence
+		if err := json.Unmarshal(message.Data, &presence); err != nil {
+			app.logger.Error("failed to read presence", "slug", slug, "error", err.Error())
+			return liveServerMessage{}, false
+		}
+
+		usernames, isNew := app.presence.Update(liveTopic(slug), presence.Instance, presence.Users)
+		// an instance that just got its first users hasn't heard of the users of the others
+		if isNew && presence.Instance != app.presence.Instance() {
+			if members := app.presence.Members(liveTopic(slug)); len(members) > 0 {
+				app.publishPresence(r.Context(), slug, members)
+			}
+		}
+		return liveServerMessage{Type: message.Event, Data: envelope{"users": usernames}}, true
+	case liveMessageComment:
+		if app.hidesComment(r.Context(), user, message) {
+			return liveServerMessage{}, false
+		}
+	}
+
+	return liveServerMessage{Type: message.Event, Data: message.Data}, true
+}
+
+// publishPresence publishes the users connected to this instance. Each instance publishes its own users,
+// the instances combine them in prepareLiveHubMessage.
+func (app *application) publishPresence(ctx context.Context, slug string, usernames []string) {
+	presence := livePresence{Instance: app.presence.Instance(), Users: usernames}
+	if err := app.hub.Publish(ctx, liveTopic(slug), liveMessagePresence, presence); err != nil {
+		app.logger.Error("failed to publish presence", "slug", slug, "error", err.Error())
+	}
+}
+
+func (app *application) writeLiveMessage(conn *websocket.Conn, message liveServerMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(liveWriteWait)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(message)
+}
+
+// liveErrorMessage mirrors the body of errorResponse.
+func liveErrorMessage(id string, appError *AppError) liveServerMessage {
+	errorDetails := map[string]any{}
+	if appError.ErrorMessage != "" {
+		errorDetails["errorMessage"] = appError.ErrorMessage
+	}
+	if appError.ErrorDetails != nil {
+		errorDetails["errorDetails"] = appError.ErrorDetails
+	}
+	return liveServerMessage{Type: liveMessageError, ID: id, Data: errorDetails}
+}
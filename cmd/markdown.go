@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/siahsang/blog/internal/markdown"
+	"github.com/siahsang/blog/models"
+)
+
+// articleRevision identifies a version of an article body. Every update bumps UpdatedAt, so a rendered
+// revision never goes stale and the cache needs no invalidation.
+type articleRevision struct {
+	articleId int64
+	updatedAt int64
+}
+
+// renderArticle returns the article body rendered to sanitized HTML, rendering it only once per revision.
+func (app *application) renderArticle(article *models.Article) (*markdown.Document, error) {
+	revision := articleRevision{articleId: article.ID, updatedAt: article.UpdatedAt.UnixNano()}
+	if document, ok := app.renderedArticles.Get(revision); ok {
+		return document, nil
+	}
+
+	document, err := app.markdown.RenderArticle(article.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	app.renderedArticles.Store(revision, document)
+	return document, nil
+}
+
+// renderComment returns the comment body rendered to sanitized HTML, or nil when comments are served as
+// they were written.
+func (app *application) renderComment(comment *models.Comment) (*string, error) {
+	if !app.config.RenderCommentMarkdown {
+		return nil, nil
+	}
+
+	bodyHtml, err := app.markdown.RenderComment(comment.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &bodyHtml, nil
+}
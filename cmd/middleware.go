@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
 	"github.com/siahsang/blog/internal/core"
 )
 
@@ -14,21 +16,20 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
-		autherization := r.Header.Get("Authorization")
-		if autherization != "" {
-			autherizationParts := strings.Split(autherization, " ")
-			if len(autherizationParts) != 2 || autherizationParts[0] != "Token" {
-				app.invalidAuthenticationTokenResponse(w, r, xerrors.New("Authentication header must be in the format 'Token <token>'"))
-				return
-			}
-			token := autherizationParts[1]
+		token, err := requestToken(r)
+		if err != nil {
+			app.invalidAuthenticationTokenResponse(w, r, err)
+			return
+		}
+
+		if token != "" {
 			authenticate, err := app.auth.Authenticate(token, app.config.JWTSecret)
 			if err != nil {
 				app.invalidAuthenticationTokenResponse(w, r, err)
 				return
 			}
 
-			user, err := app.core.GetUserByEmail(r.Context(), authenticate.Email)
+			user, err := app.loadAuthenticatedUser(r.Context(), authenticate)
 			if err != nil {
 				if errors.Is(err, core.NoRecordFound) {
 					app.notFoundResponse(w, r)
@@ -37,6 +38,10 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 				app.internalErrorResponse(w, r, err)
 				return
 			}
+			if user.DeletedAt != nil {
+				app.invalidAuthenticationTokenResponse(w, r, xerrors.New("account is scheduled for deletion"))
+				return
+			}
 			user.Token = token
 			r = app.auth.SetAuthenticatedUser(r, user)
 		}
@@ -45,6 +50,54 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// acceptsQueryToken reports whether the endpoint accepts the token as a query parameter, for clients
+// such as EventSource and WebSocket that cannot set the Authorization header.
+func acceptsQueryToken(path string) bool {
+	if path == "/api/stream" {
+		return true
+	}
+	return strings.HasPrefix(path, "/api/articles/") && strings.HasSuffix(path, "/live")
+}
+
+// requestToken returns the token of the request, or an empty string when it is anonymous.
+func requestToken(r *http.Request) (string, error) {
+	autherization := r.Header.Get("Authorization")
+	if autherization == "" {
+		if acceptsQueryToken(r.URL.Path) {
+			return r.URL.Query().Get("token"), nil
+		}
+		return "", nil
+	}
+
+	autherizationParts := strings.Split(autherization, " ")
+	if len(autherizationParts) != 2 || autherizationParts[0] != "Token" {
+		return "", xerrors.New("Authentication header must be in the format 'Token <token>'")
+	}
+
+	return autherizationParts[1], nil
+}
+
+// loadAuthenticatedUser returns the user the token was issued for, preferring the in-memory
+// cache. Tokens issued before the user id was part of the claims always hit the database.
+func (app *application) loadAuthenticatedUser(ctx context.Context, claim *auth.UserClaim) (*auth.User, error) {
+	if claim.UserID != 0 {
+		if user, ok := app.auth.GetCachedUser(claim.UserID); ok && user.Email == claim.Email {
+			return user, nil
+		}
+	}
+
+	user, err := app.core.GetUserByEmail(ctx, claim.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.UserID == user.ID && user.DeletedAt == nil {
+		app.auth.CacheAuthenticatedUser(user)
+	}
+
+	return user, nil
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !app.auth.IsUserAuthenticated(r) {
@@ -55,6 +108,17 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	}
 }
 
+func (app *application) requireAdminUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.requireAuthenticatedUser(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := app.auth.GetAuthenticatedUser(r)
+		if !user.IsAdmin {
+			app.notPermittedResponse(w, r, xerrors.Newf("admin required"))
+			return
+		}
+		next(w, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
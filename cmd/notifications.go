@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+type NotificationResponse struct {
+	ID          int64                        `json:"id"`
+	Type        string                       `json:"type"`
+	Message     string                       `json:"message"`
+	Read        bool                         `json:"read"`
+	ActorsCount int64                        `json:"actorsCount"`
+	Actor       *NotificationActorResponse   `json:"actor,omitempty"`
+	Article     *NotificationArticleResponse `json:"article,omitempty"`
+	CreatedAt   time.Time                    `json:"createdAt"`
+	UpdatedAt   time.Time                    `json:"updatedAt"`
+}
+
+type NotificationActorResponse struct {
+	Username string  `json:"username"`
+	Image    *string `json:"image"`
+}
+
+type NotificationArticleResponse struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+func (app *application) getNotifications(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	unreadOnly := app.readString(query, "unread", "false")
+	v.Check(unreadOnly == "true" || unreadOnly == "false", "unread", "must be either true or false")
+
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	notifications, err := app.core.GetNotifications(r.Context(), user, filters, unreadOnly == "true")
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	response := make([]NotificationResponse, 0, len(notifications))
+	for _, notification := range notifications {
+		response = append(response, notificationResponse(notification))
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"notifications": response}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	count, err := app.core.CountUnreadNotifications(r.Context(), user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"unreadCount": count}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	type markReadPayload struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	type MarkReadRequest struct {
+		markReadPayload `json:"notifications"`
+	}
+
+	var markReadRequest MarkReadRequest
+
+	if err := app.readJSON(w, r, &markReadRequest); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(markReadRequest.IDs) > 0, "ids", "must be provided")
+	v.Check(len(markReadRequest.IDs) <= 100, "ids", "must contain at most 100 ids")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	updated, err := app.core.MarkNotificationsRead(r.Context(), user, markReadRequest.IDs)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"updated": updated}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	updated, err := app.core.MarkAllNotificationsRead(r.Context(), user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"updated": updated}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// handleNotificationEvent is the event bus subscriber that fans events out into notifications. The
+// notification is published before the event is recorded as processed, so an event whose notification
+// failed to publish is processed again when it is redelivered.
+func (app *application) handleNotificationEvent(ctx context.Context, event events.Event) error {
+	_, err := app.processOnce(ctx, "notifications", event, func(txCtx context.Context) error {
+		notification, err := app.core.CreateNotificationForEvent(txCtx, event)
+		if err != nil || notification == nil {
+			return err
+		}
+		return app.publishNotification(ctx, notification.UserID, notificationResponse(notification))
+	})
+	return err
+}
+
+func notificationResponse(notification *models.Notification) NotificationResponse {
+	response := NotificationResponse{
+		ID:          notification.ID,
+		Type:        notification.Type,
+		Read:        notification.ReadAt != nil,
+		ActorsCount: notification.ActorCount,
+		CreatedAt:   notification.CreatedAt,
+		UpdatedAt:   notification.UpdatedAt,
+	}
+
+	actorName := "Someone"
+	if notification.LastActorUsername != nil {
+		actorName = *notification.LastActorUsername
+		response.Actor = &NotificationActorResponse{
+			Username: *notification.LastActorUsername,
+			Image:    notification.LastActorImage,
+		}
+	}
+
+	articleTitle := ""
+	if notification.ArticleSlug != nil && notification.ArticleTitle != nil {
+		articleTitle = *notification.ArticleTitle
+		response.Article = &NotificationArticleResponse{
+			Slug:  *notification.ArticleSlug,
+			Title: *notification.ArticleTitle,
+		}
+	}
+
+	// "alice", "alice and 1 other", "alice and 4 others"
+	actors := actorName
+	switch others := notification.ActorCount - 1; {
+	case others == 1:
+		actors = fmt.Sprintf("%s and 1 other", actorName)
+	case others > 1:
+		actors = fmt.Sprintf("%s and %d others", actorName, others)
+	}
+
+	switch notification.Type {
+	case core.NotificationComment:
+		response.Message = fmt.Sprintf("%s commented on %q", actors, articleTitle)
+	case core.NotificationFavorite:
+		response.Message = fmt.Sprintf("%s favorited %q", actors, articleTitle)
+	case core.NotificationFollow:
+		response.Message = fmt.Sprintf("%s started following you", actors)
+	case core.NotificationFollowRequest:
+		response.Message = fmt.Sprintf("%s requested to follow you", actors)
+	case core.NotificationCoAuthorInvite:
+		response.Message = fmt.Sprintf("%s invited you to co-author %q", actors, articleTitle)
+	}
+
+	return response
+}
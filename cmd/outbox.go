@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/retryutils"
+)
+
+const (
+	// outboxBatchSize is how many events the relay claims at once.
+	outboxBatchSize = 100
+	// outboxLease is how long a claimed event is hidden from other relays. It must outlast dispatching
+	// the event to every handler.
+	outboxLease = time.Minute
+	// a failed event is dispatched again after 1s, 2s, 4s... up to 5 minutes
+	outboxFirstRetryDelay = time.Second
+	outboxMaxRetryDelay   = 5 * time.Minute
+)
+
+// runOutboxRelay dispatches the events recorded in the outbox to the event bus until ctx is cancelled.
+func (app *application) runOutboxRelay(ctx context.Context) {
+	ticker := time.NewTicker(app.config.OutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		app.relayOutboxEvents(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) relayOutboxEvents(ctx context.Context) {
+	for {
+		outboxEvents, err := app.core.ClaimOutboxEvents(ctx, outboxBatchSize, outboxLease, app.config.OutboxMaxAttempts)
+		if err != nil {
+			app.logger.Error("failed to claim outbox events", "error", err.Error())
+			return
+		}
+
+		for _, outboxEvent := range outboxEvents {
+			if ctx.Err() != nil {
+				// the lease runs out and the remaining events are claimed again on the next start
+				return
+			}
+			app.relayOutboxEvent(ctx, outboxEvent)
+		}
+
+		if len(outboxEvents) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+func (app *application) relayOutboxEvent(ctx context.Context, outboxEvent *core.OutboxEvent) {
+	dispatchErr := app.events.Dispatch(outboxEvent.Event)
+	if dispatchErr == nil {
+		if err := app.core.MarkOutboxEventDispatched(ctx, outboxEvent.ID); err != nil {
+			app.logger.Error("failed to mark outbox event dispatched", "id", outboxEvent.ID, "error", err.Error())
+		}
+		return
+	}
+
+	// every handler sees the event again on retry, the ones that succeeded skip it as already processed
+	retryAt := time.Now().Add(retryutils.Backoff(outboxEvent.Attempts, outboxFirstRetryDelay, outboxMaxRetryDelay))
+	if err := app.core.MarkOutboxEventFailed(ctx, outboxEvent.ID, dispatchErr, retryAt); err != nil {
+		app.logger.Error("failed to mark outbox event failed", "id", outboxEvent.ID, "error", err.Error())
+		return
+	}
+
+	if outboxEvent.Attempts >= app.config.OutboxMaxAttempts {
+		app.logger.Error("giving up on outbox event", "id", outboxEvent.ID, "type", outboxEvent.Event.Type,
+			"attempts", outboxEvent.Attempts)
+	}
+}
+
+// pruneOutbox is the recurring job that deletes the dispatched events older than the retention.
+func (app *application) pruneOutbox(ctx context.Context, _ struct{}) error {
+	deleted, err := app.core.PruneOutbox(ctx, app.config.OutboxRetention)
+	if err != nil {
+		return err
+	}
+	app.logger.Info("pruned outbox", "deleted", deleted)
+	return nil
+}
+
+// processOnce runs fn in a transaction unless the consumer already processed the event, and reports
+// whether fn ran. Recording the event in the same transaction keeps redelivered events from being
+// processed twice.
+func (app *application) processOnce(ctx context.Context, consumer string, event events.Event, fn func(txCtx context.Context) error) (bool, error) {
+	return databaseutils.DoTransactionally(ctx, app.session, func(txCtx context.Context) (bool, error) {
+		first, err := app.core.MarkEventProcessed(txCtx, consumer, event)
+		if err != nil || !first {
+			return false, err
+		}
+		return true, fn(txCtx)
+	})
+}
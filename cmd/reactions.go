@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+// variationSelector asks for the emoji presentation of a character. Clients send some emoji with it and
+// some without, so it is ignored when matching a reaction.
+const variationSelector = "\uFE0F"
+
+// reactToArticle serves POST /api/articles/:slug/reactions with a body of {"reaction": "👍"}.
+func (app *application) reactToArticle(w http.ResponseWriter, r *http.Request) {
+	reaction, ok := app.readReactionBody(w, r)
+	if !ok {
+		return
+	}
+	app.changeArticleReaction(w, r, reaction, app.core.ReactToArticle)
+}
+
+// unreactToArticle serves DELETE /api/articles/:slug/reactions/:reaction.
+func (app *application) unreactToArticle(w http.ResponseWriter, r *http.Request) {
+	reaction, ok := app.readReactionParam(w, r)
+	if !ok {
+		return
+	}
+	app.changeArticleReaction(w, r, reaction, app.core.UnreactToArticle)
+}
+
+// reactToComment serves POST /api/articles/:slug/comments/:id/reactions with a body of {"reaction": "👍"}.
+func (app *application) reactToComment(w http.ResponseWriter, r *http.Request) {
+	reaction, ok := app.readReactionBody(w, r)
+	if !ok {
+		return
+	}
+	app.changeCommentReaction(w, r, reaction, app.core.ReactToComment)
+}
+
+// unreactToComment serves DELETE /api/articles/:slug/comments/:id/reactions/:reaction.
+func (app *application) unreactToComment(w http.ResponseWriter, r *http.Request) {
+	reaction, ok := app.readReactionParam(w, r)
+	if !ok {
+		return
+	}
+	app.changeCommentReaction(w, r, reaction, app.core.UnreactToComment)
+}
+
+func (app *application) changeArticleReaction(w http.ResponseWriter, r *http.Request, reaction string,
+	change func(ctx context.Context, slug string, user *auth.User, reaction string) (*models.Article, error)) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := change(r.Context(), slug, user, reaction)
+	if err != nil {
+		app.reactionErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := prepareSingleArticleResponse(r, article, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) changeCommentReaction(w http.ResponseWriter, r *http.Request, reaction string,
+	change func(ctx context.Context, slug string, commentId int64, user *auth.User, reaction string) (*models.Comment, error)) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+	commentId, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: "id must be a valid integer",
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	comment, err := change(r.Context(), slug, commentId, user, reaction)
+	if err != nil {
+		app.reactionErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := prepareSingleCommentsResponse(app, r, comment, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reactionErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, core.NoRecordFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, core.ErrBlockedByUser):
+		app.forbiddenResponse(w, r, err)
+	default:
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readReactionBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request struct {
+		Reaction string `json:"reaction"`
+	}
+	if err := app.readJSON(w, r, &request); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return "", false
+	}
+	return app.checkReaction(w, r, request.Reaction)
+}
+
+// readReactionParam reads the reaction to remove. A reaction that was removed from the configured set can
+// still be taken back.
+func (app *application) readReactionParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	reaction := strings.TrimSpace(params.ByName("reaction"))
+	if allowed, ok := app.matchReaction(reaction); ok {
+		return allowed, true
+	}
+
+	v := validator.New()
+	v.CheckNotBlank(reaction, "reaction", "must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return "", false
+	}
+	return reaction, true
+}
+
+// checkReaction checks that the reaction is in the configured set and returns it as configured.
+func (app *application) checkReaction(w http.ResponseWriter, r *http.Request, reaction string) (string, bool) {
+	if allowed, ok := app.matchReaction(reaction); ok {
+		return allowed, true
+	}
+
+	v := validator.New()
+	v.AddError("reaction", "must be one of "+strings.Join(app.config.Reactions, " "))
+	app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+	return "", false
+}
+
+func (app *application) matchReaction(reaction string) (string, bool) {
+	wanted := strings.ReplaceAll(strings.TrimSpace(reaction), variationSelector, "")
+	for _, allowed := range app.config.Reactions {
+		if strings.ReplaceAll(allowed, variationSelector, "") == wanted {
+			return allowed, true
+		}
+	}
+	return "", false
+}
+
+// orderReactions puts the reactions in the configured order. Reactions that were removed from the set
+// keep being shown after the others, in the order they were first used.
+func (app *application) orderReactions(reactions []models.ReactionCount) []models.ReactionCount {
+	ordered := slices.Clone(reactions)
+	if ordered == nil {
+		ordered = []models.ReactionCount{}
+	}
+
+	position := func(reaction string) int {
+		if index := slices.Index(app.config.Reactions, reaction); index >= 0 {
+			return index
+		}
+		return len(app.config.Reactions)
+	}
+	slices.SortStableFunc(ordered, func(a, b models.ReactionCount) int {
+		return position(a.Reaction) - position(b.Reaction)
+	})
+	return ordered
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+// relatedArticlesRanked is how many related articles are ranked and cached per article, enough to fill the
+// largest page after the articles a viewer can't see are left out.
+const relatedArticlesRanked = 50
+
+// relatedArticlesKey identifies what the related articles of an article are ranked from. It follows edits
+// the way articleRevision does, and carries the tag ids as well because a tag merge retags articles
+// without touching them.
+type relatedArticlesKey struct {
+	articleId int64
+	updatedAt int64
+	tagIds    string
+}
+
+func (app *application) getRelatedArticles(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := strings.TrimSpace(params.ByName("slug"))
+
+	v := validator.New()
+	v.CheckNotBlank(slug, "slug", "slug must be provided")
+	limit := app.readInt(r.URL.Query(), "limit", 5, v)
+	v.Check(limit > 0, "limit", "must be greater than 0")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	article, err := app.core.GetArticleBySlugForViewer(r.Context(), slug, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	relatedIds, err := app.rankRelatedArticles(r, article)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	articles, err := app.core.GetArticlesByIdsForViewer(r.Context(), relatedIds, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+	if int64(len(articles)) > limit {
+		articles = articles[:limit]
+	}
+
+	response, err := prepareMultiArticleResponse(r, articles, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// rankRelatedArticles returns the ids of the articles related to the article, ranking them only once per
+// revision and tag set of the article.
+func (app *application) rankRelatedArticles(r *http.Request, article *models.Article) ([]int64, error) {
+	tagsByArticle, err := app.core.GetTagsByArticleId(r.Context(), []int64{article.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	var tagIds []int64
+	for _, tag := range tagsByArticle[article.ID] {
+		tagIds = append(tagIds, tag.ID)
+	}
+	slices.Sort(tagIds)
+
+	var tagIdList strings.Builder
+	for _, tagId := range tagIds {
+		tagIdList.WriteString(strconv.FormatInt(tagId, 10) + ",")
+	}
+
+	key := relatedArticlesKey{articleId: article.ID, updatedAt: article.UpdatedAt.UnixNano(), tagIds: tagIdList.String()}
+	if relatedIds, ok := app.relatedArticles.Get(key); ok {
+		return relatedIds, nil
+	}
+
+	relatedIds, err := app.core.GetRelatedArticleIds(r.Context(), article.ID, relatedArticlesRanked)
+	if err != nil {
+		return nil, err
+	}
+
+	app.relatedArticles.Store(key, relatedIds)
+	return relatedIds, nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/collectionutils"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/functional"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+type SeriesEnvelope struct {
+	Slug          string           `json:"slug"`
+	Title         string           `json:"title"`
+	Description   string           `json:"description"`
+	ArticlesCount int64            `json:"articlesCount"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	UpdatedAt     time.Time        `json:"updatedAt"`
+	Author        SeriesAuthorBody `json:"author"`
+	Articles      any              `json:"articles,omitempty"`
+}
+
+type SeriesAuthorBody struct {
+	Username  string  `json:"username"`
+	Bio       *string `json:"bio"`
+	Image     *string `json:"image"`
+	Following bool    `json:"following"`
+}
+
+func (app *application) createSeries(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Series struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		} `json:"series"`
+	}
+	if err := app.readJSON(w, r, &request); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	title := strings.TrimSpace(request.Series.Title)
+	v := validator.New()
+	v.CheckNotBlank(title, "title", "must be provided")
+	slug := app.core.CreateSlug(title)
+	v.Check(title == "" || slug != "", "title", "must contain a letter or digit")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	series, err := app.core.CreateSeries(r.Context(), &models.Series{
+		Slug:        slug,
+		Title:       title,
+		Description: strings.TrimSpace(request.Series.Description),
+		AuthorID:    user.ID,
+	})
+	if err != nil {
+		if errors.Is(err, core.ErrDuplicatedSeriesSlug) {
+			v.AddError("slug", "Slug already exists")
+			app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors, ErrorStack: err})
+			return
+		}
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSeriesResponse(w, r, http.StatusCreated, series, user)
+}
+
+// getSeriesList serves GET /api/series, optionally narrowed down to the series of ?author=username.
+func (app *application) getSeriesList(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	author := app.readString(query, "author", "")
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	seriesList, err := app.core.GetSeriesList(r.Context(), filters, author, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	seriesEnvelopes, err := app.prepareSeriesEnvelopes(r, seriesList, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"series": seriesEnvelopes}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// getSeries serves GET /api/series/:slug, the series with its articles in order.
+func (app *application) getSeries(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	user, _ := app.auth.GetAuthenticatedUser(r)
+
+	series, err := app.core.GetSeriesBySlug(r.Context(), params.ByName("slug"), user)
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSeriesResponse(w, r, http.StatusOK, series, user)
+}
+
+func (app *application) updateSeries(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Series struct {
+			Title       *string `json:"title"`
+			Description *string `json:"description"`
+		} `json:"series"`
+	}
+	if err := app.readJSON(w, r, &request); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	v := validator.New()
+	if request.Series.Title != nil {
+		v.CheckNotBlank(*request.Series.Title, "title", "must not be blank")
+	}
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	// the slug is kept on a new title, so links to the series don't break
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	series, err := app.changeSeries(r, user, func(txCtx context.Context, series *models.Series) (*models.Series, error) {
+		if request.Series.Title != nil {
+			series.Title = strings.TrimSpace(*request.Series.Title)
+		}
+		if request.Series.Description != nil {
+			series.Description = strings.TrimSpace(*request.Series.Description)
+		}
+		return app.core.UpdateSeries(txCtx, series)
+	})
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSeriesResponse(w, r, http.StatusOK, series, user)
+}
+
+// deleteSeries deletes the series, keeping its articles.
+func (app *application) deleteSeries(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	_, err := app.changeSeries(r, user, func(txCtx context.Context, series *models.Series) (*models.Series, error) {
+		return series, app.core.DeleteSeries(txCtx, series)
+	})
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// addSeriesArticle serves POST /api/series/:slug/articles with a body of {"article": "slug", "position": 2}.
+// Without a position the article becomes the last part.
+func (app *application) addSeriesArticle(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Article  string `json:"article"`
+		Position int    `json:"position"`
+	}
+	if err := app.readJSON(w, r, &request); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	v := validator.New()
+	v.CheckNotBlank(request.Article, "article", "must be provided")
+	v.Check(request.Position >= 0, "position", "must not be negative")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	series, err := app.changeSeries(r, user, func(txCtx context.Context, series *models.Series) (*models.Series, error) {
+		article, err := app.core.GetArticleBySlug(txCtx, strings.TrimSpace(request.Article))
+		if err != nil {
+			return nil, err
+		}
+		return series, app.core.AddArticleToSeries(txCtx, series, article, request.Position)
+	})
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSeriesResponse(w, r, http.StatusOK, series, user)
+}
+
+// reorderSeries serves PUT /api/series/:slug/articles with a body of {"articles": ["slug", ...]} listing
+// every article of the series in the new order.
+func (app *application) reorderSeries(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Articles []string `json:"articles"`
+	}
+	if err := app.readJSON(w, r, &request); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	series, err := app.changeSeries(r, user, func(txCtx context.Context, series *models.Series) (*models.Series, error) {
+		articleIds := make([]int64, 0, len(request.Articles))
+		for _, slug := range request.Articles {
+			article, err := app.core.GetArticleBySlug(txCtx, strings.TrimSpace(slug))
+			if errors.Is(err, core.NoRecordFound) {
+				return nil, xerrors.New(core.ErrInvalidSeriesOrder)
+			}
+			if err != nil {
+				return nil, err
+			}
+			articleIds = append(articleIds, article.ID)
+		}
+		return series, app.core.ReorderSeries(txCtx, series, articleIds)
+	})
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSeriesResponse(w, r, http.StatusOK, series, user)
+}
+
+// removeSeriesArticle serves DELETE /api/series/:slug/articles/:article. The article is kept.
+func (app *application) removeSeriesArticle(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	user, _ := app.auth.GetAuthenticatedUser(r)
+
+	series, err := app.changeSeries(r, user, func(txCtx context.Context, series *models.Series) (*models.Series, error) {
+		article, err := app.core.GetArticleBySlug(txCtx, params.ByName("article"))
+		if err != nil {
+			return nil, err
+		}
+		return series, app.core.RemoveArticleFromSeries(txCtx, series, article)
+	})
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSeriesResponse(w, r, http.StatusOK, series, user)
+}
+
+// changeSeries runs change on the series of the slug in a transaction, if the user may change it.
+func (app *application) changeSeries(r *http.Request, user *auth.User,
+	change func(txCtx context.Context, series *models.Series) (*models.Series, error)) (*models.Series, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	return databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Series, error) {
+		series, err := app.core.GetSeriesBySlug(txCtx, params.ByName("slug"), user)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.auth.CheckUserCanChangeSeries(user, series.AuthorID); err != nil {
+			return nil, err
+		}
+
+		return change(txCtx, series)
+	})
+}
+
+// writeSeriesResponse responds with the series and its articles, reloaded to reflect any change to them.
+func (app *application) writeSeriesResponse(w http.ResponseWriter, r *http.Request, status int, series *models.Series, user *auth.User) {
+	series, err := app.core.GetSeriesBySlug(r.Context(), series.Slug, user)
+	if err != nil {
+		app.seriesErrorResponse(w, r, err)
+		return
+	}
+
+	seriesEnvelopes, err := app.prepareSeriesEnvelopes(r, []*models.Series{series}, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	articles, err := app.core.GetSeriesArticles(r.Context(), series, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+	articlesResponse, err := prepareMultiArticleResponse(r, articles, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+	seriesEnvelopes[0].Articles = articlesResponse["articles"]
+
+	if err := app.writeJSON(w, status, envelope{"series": seriesEnvelopes[0]}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) prepareSeriesEnvelopes(r *http.Request, seriesList []*models.Series, user *auth.User) ([]*SeriesEnvelope, error) {
+	authors, err := app.core.GetUsersByIdList(r.Context(), functional.Map(seriesList, func(series *models.Series) int64 {
+		return series.AuthorID
+	}))
+	if err != nil {
+		return nil, err
+	}
+	authorById := collectionutils.Associate(authors, func(author *auth.User) (int64, *auth.User) {
+		return author.ID, author
+	})
+
+	var followingUserList []*auth.User
+	if user != nil {
+		followingUserList, err = app.core.GetFollowingUserList(r.Context(), user.Username)
+		if err != nil {
+			return nil, err
+		}
+	}
+	followingUserById := collectionutils.Associate(followingUserList, func(user *auth.User) (int64, bool) {
+		return user.ID, true
+	})
+
+	seriesEnvelopes := []*SeriesEnvelope{}
+	for _, series := range seriesList {
+		author := authorById[series.AuthorID]
+		seriesEnvelopes = append(seriesEnvelopes, &SeriesEnvelope{
+			Slug:          series.Slug,
+			Title:         series.Title,
+			Description:   series.Description,
+			ArticlesCount: series.ArticlesCount,
+			CreatedAt:     series.CreatedAt,
+			UpdatedAt:     series.UpdatedAt,
+			Author: SeriesAuthorBody{
+				Username:  author.Username,
+				Bio:       author.Bio,
+				Image:     author.Image,
+				Following: followingUserById[series.AuthorID],
+			},
+		})
+	}
+	return seriesEnvelopes, nil
+}
+
+func (app *application) seriesErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, core.NoRecordFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, auth.NotAuthorizeToChangeSeries):
+		app.notPermittedResponse(w, r, err)
+	case errors.Is(err, core.ErrArticleInOtherSeries), errors.Is(err, core.ErrArticleNotInSeries),
+		errors.Is(err, core.ErrArticleOfOtherAuthor), errors.Is(err, core.ErrSeriesPositionTooLarge),
+		errors.Is(err, core.ErrInvalidSeriesOrder):
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+	default:
+		app.internalErrorResponse(w, r, err)
+	}
+}
@@ -21,6 +21,19 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// streams never finish on their own, so closing the hub is what lets Shutdown return
+	server.RegisterOnShutdown(app.hub.Close)
+
+	// backgroundCtx is cancelled on shutdown so long-running workers can stop before wg is drained
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	app.doInBackground(func() { app.jobs.Run(backgroundCtx) })
+	app.doInBackground(func() { app.runOutboxRelay(backgroundCtx) })
+	app.doInBackground(func() { app.hub.Run(backgroundCtx) })
+	app.doInBackground(func() { app.runWebhookDispatcher(backgroundCtx) })
+	app.doInBackground(func() { app.runViewFlusher(backgroundCtx) })
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -35,6 +48,7 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
+		stopBackground()
 		app.logger.Info("completing background tasks", "address", server.Addr)
 		app.wg.Wait()
 		shutdownError <- nil
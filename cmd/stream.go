@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/pubsub"
+	"github.com/siahsang/blog/internal/validator"
+)
+
+// maxStreamArticles bounds how many articles a single stream can follow.
+const maxStreamArticles = 50
+
+// Stream events
+const (
+	streamEventComment      = "comment"
+	streamEventFavorites    = "favorites"
+	streamEventNotification = "notification"
+)
+
+type FavoritesCountResponse struct {
+	Slug           string `json:"slug"`
+	FavoritesCount int64  `json:"favoritesCount"`
+}
+
+func articleTopic(slug string) string {
+	return "articles/" + slug
+}
+
+func userTopic(userId int64) string {
+	return fmt.Sprintf("users/%d", userId)
+}
+
+// stream pushes real-time updates as Server-Sent Events: new comments and favorite counts of the
+// articles listed in ?articles=slug1,slug2, and new notifications of the authenticated user.
+func (app *application) stream(w http.ResponseWriter, r *http.Request) {
+	var slugs []string
+	for _, slug := range strings.Split(app.readString(r.URL.Query(), "articles", ""), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+
+	v := validator.New()
+	v.Check(len(slugs) <= maxStreamArticles, "articles", fmt.Sprintf("must contain at most %d articles", maxStreamArticles))
+	v.Check(len(slugs) > 0 || user != nil, "articles", "must be provided for anonymous streams")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	var topics []string
+	for _, slug := range slugs {
+		if _, err := app.core.GetArticleBySlugForViewer(r.Context(), slug, user); err != nil {
+			switch {
+			case errors.Is(err, core.NoRecordFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.internalErrorResponse(w, r, err)
+			}
+			return
+		}
+		topics = append(topics, articleTopic(slug))
+	}
+
+	if user != nil {
+		topics = append(topics, userTopic(user.ID))
+	}
+
+	// the stream outlives the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	subscription := app.hub.Subscribe(topics...)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, ok := <-subscription.C:
+			// the hub is closed on shutdown
+			if !ok {
+				return
+			}
+			if message.Event == streamEventComment && app.hidesComment(r.Context(), user, message) {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Event, message.Data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handleStreamEvent is the event bus subscriber that publishes article updates to the streams following them.
+// A redelivered event is published again; clients tell comments apart by id and favorite counts are absolute.
+func (app *application) handleStreamEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.CommentCreated:
+		return app.publishComment(ctx, event)
+	case events.ArticleFavorited, events.ArticleUnfavorited:
+		return app.publishFavoritesCount(ctx, event)
+	}
+	return nil
+}
+
+func (app *application) publishComment(ctx context.Context, event events.Event) error {
+	article, err := app.core.GetArticleById(ctx, event.ArticleID)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	comment, err := app.core.GetCommentById(ctx, event.CommentID)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	// the message goes to every viewer, so the author is described without a viewer
+	profile, err := app.core.GetProfileByUserId(ctx, comment.AuthorID, nil)
+	if err != nil {
+		return err
+	}
+
+	bodyHtml, err := app.renderComment(comment)
+	if err != nil {
+		return err
+	}
+
+	return app.hub.Publish(ctx, articleTopic(article.Slug), streamEventComment, envelope{
+		"slug": article.Slug,
+		"comment": CommentResponse{
+			ID:        comment.ID,
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+			Body:      comment.Body,
+			BodyHTML:  bodyHtml,
+			Author: &CommentAuthorBody{
+				Username: profile.Username,
+				Bio:      profile.Bio,
+				Image:    profile.Image,
+			},
+		},
+	})
+}
+
+func (app *application) publishFavoritesCount(ctx context.Context, event events.Event) error {
+	article, err := app.core.GetArticleById(ctx, event.ArticleID)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	count, err := app.core.FavouriteArticleCount(ctx, article.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.hub.Publish(ctx, articleTopic(article.Slug), streamEventFavorites, FavoritesCountResponse{
+		Slug:           article.Slug,
+		FavoritesCount: count,
+	})
+}
+
+// hidesComment reports whether the published comment is left out for the user because they have muted
+// or blocked its author. A comment that can't be checked is left out as well.
+func (app *application) hidesComment(ctx context.Context, user *auth.User, message pubsub.Message) bool {
+	if user == nil {
+		return false
+	}
+
+	var data struct {
+		Comment CommentResponse `json:"comment"`
+	}
+	if err := json.Unmarshal(message.Data, &data); err != nil || data.Comment.Author == nil {
+		return false
+	}
+
+	isIgnored, err := app.core.IsIgnoredBy(ctx, data.Comment.Author.Username, user.ID)
+	if err != nil {
+		app.logger.Error("failed to check whether the comment author is ignored", "topic", message.Topic, "error", err.Error())
+		return true
+	}
+	return isIgnored
+}
+
+// ignoreNotFound drops the error of an article or comment that was deleted before its event was
+// dispatched, so the event isn't retried for something that is gone.
+func ignoreNotFound(err error) error {
+	if errors.Is(err, core.NoRecordFound) {
+		return nil
+	}
+	return err
+}
+
+func (app *application) publishNotification(ctx context.Context, userId int64, notification NotificationResponse) error {
+	return app.hub.Publish(ctx, userTopic(userId), streamEventNotification, envelope{"notification": notification})
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/tagging"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/functional"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+// getTagList returns the tags the most used first. "tags" keeps holding just the display names, as
+// clients of the RealWorld API expect, "tagDetails" adds the canonical names, article counts and descriptions.
+func (app *application) getTagList(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	limit := app.readTagLimit(r.URL.Query(), v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	viewer, _ := app.auth.GetAuthenticatedUser(r)
+	tags, err := app.core.GetTagsList(r.Context(), viewer, limit)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	tagNames := functional.Map(tags, func(t *models.Tag) string {
+		return t.DisplayName
+	})
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{
+		"tags":       tagNames,
+		"tagDetails": tags,
+	}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+}
+
+// getTrendingTagsRoute serves GET /api/tags/trending. The route is declared as /api/tags/:tag because it
+// shares the segment with /api/tags/:tag/follow, so any other tag is not found here; single tags are only
+// served to admins under /api/admin/tags/:tag.
+func (app *application) getTrendingTagsRoute(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	if params.ByName("tag") != core.TrendingSlug {
+		app.notFoundResponse(w, r)
+		return
+	}
+	app.getTrendingTags(w, r)
+}
+
+func (app *application) getTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// updateTag renames a tag or changes its description.
+func (app *application) updateTag(w http.ResponseWriter, r *http.Request) {
+	type updateTagPayload struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	type UpdateTagRequest struct {
+		updateTagPayload `json:"tag"`
+	}
+
+	var updateTagRequest UpdateTagRequest
+
+	if err := app.readJSON(w, r, &updateTagRequest); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	if updateTagRequest.Name != nil {
+		tag.Name = tagging.Normalize(*updateTagRequest.Name)
+		tag.DisplayName = tagging.Display(*updateTagRequest.Name)
+		checkTagName(v, "name", tag.Name, app.tagRules())
+	}
+	if updateTagRequest.Description != nil {
+		tag.Description = strings.TrimSpace(*updateTagRequest.Description)
+		v.Check(len(tag.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	}
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	updatedTag, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Tag, error) {
+		return app.core.UpdateTag(txCtx, tag)
+	})
+	if err != nil {
+		app.tagErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"tag": updatedTag}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// createTagAlias makes a name resolve to the tag, e.g. "golang" to "go".
+func (app *application) createTagAlias(w http.ResponseWriter, r *http.Request) {
+	var createTagAliasRequest struct {
+		Alias string `json:"alias"`
+	}
+
+	if err := app.readJSON(w, r, &createTagAliasRequest); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	alias := tagging.Normalize(createTagAliasRequest.Alias)
+	v := validator.New()
+	checkTagName(v, "alias", alias, app.tagRules())
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	updatedTag, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Tag, error) {
+		return app.core.CreateTagAlias(txCtx, tag, alias)
+	})
+	if err != nil {
+		app.tagErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusCreated, envelope{"tag": updatedTag}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTagAlias(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+	updatedTag, err := app.core.DeleteTagAlias(r.Context(), tag, tagging.Normalize(params.ByName("alias")))
+	if err != nil {
+		app.tagErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"tag": updatedTag}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// mergeTag moves the articles and aliases of the tag into another one and deletes it.
+func (app *application) mergeTag(w http.ResponseWriter, r *http.Request) {
+	var mergeTagRequest struct {
+		Into string `json:"into"`
+	}
+
+	if err := app.readJSON(w, r, &mergeTagRequest); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	into := tagging.Normalize(mergeTagRequest.Into)
+	v := validator.New()
+	v.CheckNotBlank(into, "into", "must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	source, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	mergedTag, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Tag, error) {
+		target, err := app.core.GetTagByName(txCtx, into)
+		if err != nil {
+			return nil, err
+		}
+		return app.core.MergeTags(txCtx, source, target)
+	})
+	if err != nil {
+		app.tagErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"tag": mergedTag}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) followTag(w http.ResponseWriter, r *http.Request) {
+	app.changeTagFollow(w, r, app.core.FollowTag, true)
+}
+
+func (app *application) unfollowTag(w http.ResponseWriter, r *http.Request) {
+	app.changeTagFollow(w, r, app.core.UnfollowTag, false)
+}
+
+func (app *application) changeTagFollow(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, user *auth.User, name string) (*models.Tag, error), following bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	name := tagging.Normalize(params.ByName("tag"))
+
+	v := validator.New()
+	v.CheckNotBlank(name, "tag", "must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	tag, err := change(r.Context(), user, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, core.TagIsAlreadyFollowed), errors.Is(err, core.TagIsNotFollowed):
+			app.badRequestResponse(w, r, &AppError{
+				ErrorMessage: err.Error(),
+				ErrorStack:   err,
+			})
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"tag": tag, "following": following}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// pruneOrphanTags is the recurring job that deletes the tags no article uses anymore.
+func (app *application) pruneOrphanTags(ctx context.Context, _ struct{}) error {
+	deleted, err := app.core.DeleteOrphanTags(ctx, app.config.OrphanTagGracePeriod)
+	if err != nil {
+		return err
+	}
+	app.logger.Info("pruned orphan tags", "deleted", deleted)
+	return nil
+}
+
+// readTag loads the tag named in the URL. It writes the error response itself and reports whether the
+// handler can go on.
+func (app *application) readTag(w http.ResponseWriter, r *http.Request) (*models.Tag, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	tag, err := app.core.GetTagByName(r.Context(), tagging.Normalize(params.ByName("tag")))
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return tag, true
+}
+
+// readTagLimit reads the optional limit of a tag list, 0 when every tag is wanted.
+func (app *application) readTagLimit(query url.Values, v *validator.Validator) int64 {
+	limit := app.readInt(query, "limit", 0, v)
+	if query.Has("limit") {
+		v.Check(limit > 0, "limit", "must be greater than 0")
+		v.Check(limit <= 100, "limit", "must be a maximum of 100")
+	}
+	return limit
+}
+
+func (app *application) tagRules() tagging.Rules {
+	return tagging.Rules{MaxTags: app.config.MaxTagsPerArticle, MaxLength: app.config.MaxTagLength}
+}
+
+// checkTagName checks a canonical name given outside of a tag list, e.g. the new name of a tag.
+func checkTagName(v *validator.Validator, key string, name string, rules tagging.Rules) {
+	v.CheckNotBlank(name, key, "must be provided")
+	v.Check(utf8.RuneCountInString(name) <= rules.MaxLength, key, fmt.Sprintf("must not be longer than %d characters", rules.MaxLength))
+}
+
+func (app *application) tagErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, core.NoRecordFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, core.ErrDuplicateTag), errors.Is(err, core.ErrTagAliasInUse), errors.Is(err, core.ErrMergeTagIntoItself):
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+	default:
+		app.internalErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/functional"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+// getTrendingArticles serves GET /api/articles/trending, which getArticle dispatches to since the path
+// shares its route with the article slugs.
+func (app *application) getTrendingArticles(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	articles, err := app.core.GetTrendingArticles(r.Context(), filters, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := prepareMultiArticleResponse(r, articles, app, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, response, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// getTrendingTags serves GET /api/tags/trending, which getTrendingTagsRoute dispatches to.
+func (app *application) getTrendingTags(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	limit := app.readTagLimit(r.URL.Query(), v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	tags, err := app.core.GetTrendingTags(r.Context(), limit)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	tagNames := functional.Map(tags, func(t *models.Tag) string {
+		return t.DisplayName
+	})
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{
+		"tags":       tagNames,
+		"tagDetails": tags,
+	}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// refreshTrending is the recurring job that recomputes the trending articles and tags.
+func (app *application) refreshTrending(ctx context.Context, _ struct{}) error {
+	return app.session.DoTransactionally(ctx, func(txCtx context.Context) error {
+		return app.core.RefreshTrending(txCtx, time.Now(), app.config.TrendingWindow, app.config.TrendingHalfLife)
+	})
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/images"
+	"github.com/siahsang/blog/internal/storage"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
+)
+
+var (
+	errNotMultipart     = xerrors.Message("body must be multipart/form-data")
+	errMissingImageFile = xerrors.Message("the image must be sent in the \"file\" field")
+	errImageTooLarge    = xerrors.Message("image file is too large")
+)
+
+// multipartOverhead is what the body may hold on top of the image file: boundaries and part headers.
+const multipartOverhead = 64 << 10
+
+func (app *application) uploadImage(w http.ResponseWriter, r *http.Request) {
+	data, err := app.readImageFile(w, r)
+	if err != nil {
+		app.imageUploadErrorResponse(w, r, err)
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	upload, err := app.storeImage(r.Context(), user, data)
+	if err != nil {
+		app.imageUploadErrorResponse(w, r, err)
+		return
+	}
+
+	created, err := app.core.CreateUpload(r.Context(), upload)
+	if err != nil {
+		app.deleteStoredImage(upload)
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusCreated, envelope{"upload": app.uploadResponse(created)}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// uploadUserImage replaces the image of the authenticated user with an uploaded one, which points at the
+// thumbnail of the configured avatar width.
+func (app *application) uploadUserImage(w http.ResponseWriter, r *http.Request) {
+	data, err := app.readImageFile(w, r)
+	if err != nil {
+		app.imageUploadErrorResponse(w, r, err)
+		return
+	}
+
+	authenticatedUser, _ := app.auth.GetAuthenticatedUser(r)
+	upload, err := app.storeImage(r.Context(), authenticatedUser, data)
+	if err != nil {
+		app.imageUploadErrorResponse(w, r, err)
+		return
+	}
+
+	imageKey := upload.Key
+	for _, variant := range upload.Variants {
+		if variant.Width == app.config.AvatarWidth {
+			imageKey = variant.Key
+		}
+	}
+	imageURL := app.uploadURL(imageKey)
+	authenticatedUser.Image = &imageURL
+
+	updatedUser, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*auth.User, error) {
+		if _, err := app.core.CreateUpload(txCtx, upload); err != nil {
+			return nil, err
+		}
+		return app.core.UpdateUser(txCtx, authenticatedUser)
+	})
+	if err != nil {
+		app.deleteStoredImage(upload)
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	app.auth.InvalidateCachedUser(updatedUser.ID)
+	updatedUser.Token = authenticatedUser.Token
+
+	if err := app.writeJSON(w, http.StatusOK, userResponse(updatedUser), nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// serveUpload streams an uploaded file from the storage. Keys are random and never reused, so the
+// files can be cached forever.
+func (app *application) serveUpload(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	key := strings.TrimPrefix(params.ByName("key"), "/")
+
+	file, contentType, err := app.storage.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidKey):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, file); err != nil {
+		app.logger.Error("failed to serve upload", "key", key, "error", err)
+	}
+}
+
+// readImageFile reads the "file" part of a multipart body. The size limit is checked while reading, so
+// an oversized file is rejected without being buffered.
+func (app *application) readImageFile(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := app.config.MaxImageUploadBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, xerrors.New(errNotMultipart)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, xerrors.New(errMissingImageFile)
+		}
+		if err != nil {
+			return nil, bodyReadError(err)
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		if err != nil {
+			return nil, bodyReadError(err)
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, xerrors.New(errImageTooLarge)
+		}
+		return data, nil
+	}
+}
+
+func bodyReadError(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return xerrors.New(errImageTooLarge)
+	}
+	return xerrors.Newf("error reading multipart body: %w", err)
+}
+
+// storeImage validates the image and puts it and its thumbnails into the storage under a random prefix.
+// The returned upload is not recorded yet.
+func (app *application) storeImage(ctx context.Context, user *auth.User, data []byte) (*models.Upload, error) {
+	image, err := images.Decode(data, app.config.MaxImagePixels)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails, err := image.Thumbnails(app.config.ThumbnailWidths)
+	if err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, xerrors.New(err)
+	}
+	prefix := "images/" + hex.EncodeToString(random) + "/"
+
+	upload := &models.Upload{
+		UserID:      user.ID,
+		Key:         prefix + "original" + image.Extension,
+		ContentType: image.ContentType,
+		Size:        int64(len(data)),
+		Width:       image.Width,
+		Height:      image.Height,
+		Variants:    []models.UploadVariant{},
+	}
+	if err := app.storage.Put(ctx, upload.Key, upload.ContentType, data); err != nil {
+		return nil, err
+	}
+
+	for _, thumbnail := range thumbnails {
+		variant := models.UploadVariant{
+			Key:    prefix + "w" + strconv.Itoa(thumbnail.Width) + thumbnail.Extension,
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+		}
+		if err := app.storage.Put(ctx, variant.Key, thumbnail.ContentType, thumbnail.Data); err != nil {
+			app.deleteStoredImage(upload)
+			return nil, err
+		}
+		upload.Variants = append(upload.Variants, variant)
+	}
+
+	return upload, nil
+}
+
+// deleteStoredImage removes the original and the thumbnails of an upload from the storage.
+func (app *application) deleteStoredImage(upload *models.Upload) {
+	keys := []string{upload.Key}
+	for _, variant := range upload.Variants {
+		keys = append(keys, variant.Key)
+	}
+	for _, key := range keys {
+		if err := app.storage.Delete(context.Background(), key); err != nil {
+			app.logger.Error("failed to delete stored image", "key", key, "error", err)
+		}
+	}
+}
+
+func (app *application) imageUploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errImageTooLarge):
+		app.payloadTooLargeResponse(w, r, xerrors.Newf("image file must not be larger than %d bytes", app.config.MaxImageUploadBytes))
+	case errors.Is(err, images.ErrUnsupportedType):
+		app.unsupportedMediaTypeResponse(w, r, err)
+	case errors.Is(err, errNotMultipart), errors.Is(err, errMissingImageFile),
+		errors.Is(err, images.ErrInvalidImage), errors.Is(err, images.ErrTooManyPixels):
+		app.badRequestResponse(w, r, &AppError{ErrorMessage: err.Error(), ErrorStack: err})
+	default:
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) uploadResponse(upload *models.Upload) envelope {
+	variants := []envelope{}
+	for _, variant := range upload.Variants {
+		variants = append(variants, envelope{
+			"url":    app.uploadURL(variant.Key),
+			"width":  variant.Width,
+			"height": variant.Height,
+		})
+	}
+
+	return envelope{
+		"url":         app.uploadURL(upload.Key),
+		"contentType": upload.ContentType,
+		"size":        upload.Size,
+		"width":       upload.Width,
+		"height":      upload.Height,
+		"variants":    variants,
+		"createdAt":   upload.CreatedAt,
+	}
+}
+
+// uploadURL is where the file of a key is served. The url is saved, e.g. as the image of a user, so it is
+// built from the configuration rather than from the request.
+func (app *application) uploadURL(key string) string {
+	return app.config.UploadsBaseURL + "/" + key
+}
+
+func checkImageURL(v *validator.Validator, key string, rawURL string) {
+	if parsed, err := url.Parse(rawURL); rawURL != "" && (err != nil || parsed.Host == "" ||
+		(parsed.Scheme != "http" && parsed.Scheme != "https")) {
+		v.AddError(key, "must be an absolute http or https URL")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
@@ -9,7 +10,11 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/siahsang/blog/internal/auth"
 	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/functional"
 	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/models"
 )
 
 type envelope map[string]any
@@ -100,9 +105,10 @@ func (app *application) createUser(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) updateUser(w http.ResponseWriter, r *http.Request) {
 	type updateUserPayload struct {
-		Email string  `json:"email"`
-		Bio   *string `json:"bio"`
-		Image *string `json:"image"`
+		Email   string  `json:"email"`
+		Bio     *string `json:"bio"`
+		Image   *string `json:"image"`
+		Private *bool   `json:"private"`
 	}
 
 	type UpdateUserRequest struct {
@@ -131,6 +137,10 @@ func (app *application) updateUser(w http.ResponseWriter, r *http.Request) {
 		authenticatedUser.Image = &trimmedImage
 	}
 
+	if updateUserRequest.Private != nil {
+		authenticatedUser.IsPrivate = *updateUserRequest.Private
+	}
+
 	v := validator.New()
 	checkEmail(v, updateUserRequest.Email)
 
@@ -140,9 +150,9 @@ func (app *application) updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authenticatedUser.Email = strings.TrimSpace(updateUserRequest.Email)
-	updateUser, err := app.core.UpdateUser(r.Context(), authenticatedUser)
-	updateUser.Token = authenticatedUser.Token
-
+	updateUser, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*auth.User, error) {
+		return app.core.UpdateUser(txCtx, authenticatedUser)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, core.NoRecordFound):
@@ -154,6 +164,9 @@ func (app *application) updateUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	app.auth.InvalidateCachedUser(updateUser.ID)
+	updateUser.Token = authenticatedUser.Token
+
 	if err := app.writeJSON(w, http.StatusAccepted, userResponse(updateUser), nil); err != nil {
 		app.internalErrorResponse(w, r, err)
 	}
@@ -168,7 +181,23 @@ func (app *application) getUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.writeJSON(w, http.StatusOK, userResponse(authenticatedUser), nil); err != nil {
+	followedTags, err := app.core.GetFollowedTags(r.Context(), authenticatedUser)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	type userWithFollowedTags struct {
+		*auth.User
+		FollowedTags []string `json:"followedTags"`
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"user": userWithFollowedTags{
+		User: authenticatedUser,
+		FollowedTags: functional.Map(followedTags, func(t *models.Tag) string {
+			return t.DisplayName
+		}),
+	}}, nil); err != nil {
 		app.internalErrorResponse(w, r, err)
 	}
 }
@@ -182,7 +211,8 @@ func (app *application) getProfile(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
-	profile, err := app.core.GetProfileByUserName(r.Context(), username)
+	viewer, _ := app.auth.GetAuthenticatedUser(r)
+	profile, err := app.core.GetProfileByUserName(r.Context(), username, viewer)
 	if err != nil {
 		switch {
 		case errors.Is(err, core.NoRecordFound):
@@ -217,7 +247,9 @@ func (app *application) followUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	profile, err := app.core.FollowUser(r.Context(), *authenticatedUser, followeeUsername)
+	profile, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Profile, error) {
+		return app.core.FollowUser(txCtx, *authenticatedUser, followeeUsername)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, core.NoRecordFound):
@@ -226,12 +258,15 @@ func (app *application) followUser(w http.ResponseWriter, r *http.Request) {
 				ErrorStack:   err,
 			})
 			return
-		case errors.Is(err, core.UserIsAlreadyFollowed):
+		case errors.Is(err, core.UserIsAlreadyFollowed), errors.Is(err, core.FollowIsAlreadyRequested):
 			app.badRequestResponse(w, r, &AppError{
 				ErrorMessage: err.Error(),
 				ErrorStack:   err,
 			})
 			return
+		case errors.Is(err, core.ErrBlockedByUser):
+			app.forbiddenResponse(w, r, err)
+			return
 		default:
 			app.internalErrorResponse(w, r, err)
 			return
@@ -278,6 +313,125 @@ func (app *application) unfollowUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) getFollowers(w http.ResponseWriter, r *http.Request) {
+	app.listFollowRelation(w, r, app.core.GetFollowers)
+}
+
+func (app *application) getFollowing(w http.ResponseWriter, r *http.Request) {
+	app.listFollowRelation(w, r, app.core.GetFollowing)
+}
+
+func (app *application) listFollowRelation(w http.ResponseWriter, r *http.Request,
+	list func(ctx context.Context, username string, filter filter.Filter) ([]*auth.User, error)) {
+	v := validator.New()
+	params := httprouter.ParamsFromContext(r.Context())
+	username := strings.TrimSpace(params.ByName("username"))
+	v.CheckNotBlank(username, "username", "must be provided")
+
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	users, err := list(r.Context(), username, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	viewer, _ := app.auth.GetAuthenticatedUser(r)
+	profiles, err := app.core.GetProfilesForViewer(r.Context(), users, viewer)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"profiles": profiles}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getFollowRequests(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	requesters, err := app.core.GetFollowRequests(r.Context(), user, filters)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	profiles, err := app.core.GetProfilesForViewer(r.Context(), requesters, user)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"profiles": profiles}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) approveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.core.ApproveFollowRequest)
+}
+
+func (app *application) denyFollowRequest(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.core.DenyFollowRequest)
+}
+
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request,
+	answer func(ctx context.Context, user *auth.User, requesterUserName string) (*models.Profile, error)) {
+	params := httprouter.ParamsFromContext(r.Context())
+	requesterUsername := strings.TrimSpace(params.ByName("username"))
+
+	v := validator.New()
+	v.CheckNotBlank(requesterUsername, "username", "must be provided")
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	profile, err := databaseutils.DoTransactionally(r.Context(), app.session, func(txCtx context.Context) (*models.Profile, error) {
+		return answer(txCtx, user, requesterUsername)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound), errors.Is(err, core.FollowRequestNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
 func userResponse(user *auth.User) envelope {
 	return envelope{"user": user}
 }
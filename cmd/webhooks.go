@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/core"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/validator"
+	"github.com/siahsang/blog/internal/webhooks"
+	"github.com/siahsang/blog/models"
+)
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{
+	string(events.ArticleCreated),
+	string(events.ArticleUpdated),
+	string(events.ArticlePublished),
+	string(events.ArticleDeleted),
+	string(events.CommentCreated),
+}
+
+// webhookBatchSize is how many deliveries the dispatcher sends at once.
+const webhookBatchSize = 20
+
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+type WebhookArticle struct {
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	TagList     []string  `json:"tagList,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	CreatedAt   time.Time `json:"createdAt,omitzero"`
+	UpdatedAt   time.Time `json:"updatedAt,omitzero"`
+}
+
+type WebhookComment struct {
+	ID        int64     `json:"id"`
+	Body      string    `json:"body"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (app *application) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	list, err := app.core.GetWebhooks(r.Context(), user.ID)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	for _, webhook := range list {
+		webhook.Secret = ""
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"webhooks": list}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// createWebhook registers a webhook. The signing secret is only returned in this response.
+func (app *application) createWebhook(w http.ResponseWriter, r *http.Request) {
+	type createWebhookPayload struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Global bool     `json:"global"`
+	}
+
+	type CreateWebhookRequest struct {
+		createWebhookPayload `json:"webhook"`
+	}
+
+	var createWebhookRequest CreateWebhookRequest
+
+	if err := app.readJSON(w, r, &createWebhookRequest); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	v := validator.New()
+	validateWebhook(r.Context(), v, createWebhookRequest.URL, createWebhookRequest.Events)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	if createWebhookRequest.Global && !user.IsAdmin {
+		app.notPermittedResponse(w, r, xerrors.New("only admins can register global webhooks"))
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	webhook, err := app.core.CreateWebhook(r.Context(), &models.Webhook{
+		UserID: user.ID,
+		URL:    createWebhookRequest.URL,
+		Secret: secret,
+		Events: createWebhookRequest.Events,
+		Global: createWebhookRequest.Global,
+	})
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+	if err := app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhook changes the url, events or active flag. Setting active re-enables a webhook that was
+// disabled after repeated failures.
+func (app *application) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	type updateWebhookPayload struct {
+		URL    *string   `json:"url"`
+		Events *[]string `json:"events"`
+		Active *bool     `json:"active"`
+	}
+
+	type UpdateWebhookRequest struct {
+		updateWebhookPayload `json:"webhook"`
+	}
+
+	var updateWebhookRequest UpdateWebhookRequest
+
+	if err := app.readJSON(w, r, &updateWebhookRequest); err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: err.Error(),
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if updateWebhookRequest.URL != nil {
+		webhook.URL = *updateWebhookRequest.URL
+	}
+	if updateWebhookRequest.Events != nil {
+		webhook.Events = *updateWebhookRequest.Events
+	}
+	if updateWebhookRequest.Active != nil {
+		webhook.Active = *updateWebhookRequest.Active
+	}
+
+	v := validator.New()
+	validateWebhook(r.Context(), v, webhook.URL, webhook.Events)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	updated, err := app.core.UpdateWebhook(r.Context(), webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	updated.Secret = ""
+	if err := app.writeJSON(w, http.StatusOK, envelope{"webhook": updated}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.core.DeleteWebhook(r.Context(), webhook.UserID, webhook.ID); err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	query := r.URL.Query()
+	limit := app.readInt(query, "limit", 20, v)
+	offset := app.readInt(query, "offset", 0, v)
+
+	filters := filter.NewFilter(limit, offset)
+	filter.ValidateFilters(filters, v)
+	if !v.IsValid() {
+		app.badRequestResponse(w, r, &AppError{ErrorDetails: v.Errors})
+		return
+	}
+
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.core.GetWebhookDeliveries(r.Context(), webhook.ID, filters)
+	if err != nil {
+		app.internalErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// replayWebhookDelivery queues the payload of an earlier delivery again, e.g. after fixing the receiver.
+func (app *application) replayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	deliveryId, err := strconv.ParseInt(params.ByName("deliveryId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: "deliveryId must be a valid integer",
+			ErrorStack:   err,
+		})
+		return
+	}
+
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := app.core.ReplayWebhookDelivery(r.Context(), webhook.ID, deliveryId)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusAccepted, envelope{"delivery": delivery}, nil); err != nil {
+		app.internalErrorResponse(w, r, err)
+	}
+}
+
+// readWebhook loads the webhook of the URL, which must belong to the authenticated user. It writes
+// the error response itself and reports whether the handler can go on.
+func (app *application) readWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	webhookId, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, &AppError{
+			ErrorMessage: "id must be a valid integer",
+			ErrorStack:   err,
+		})
+		return nil, false
+	}
+
+	user, _ := app.auth.GetAuthenticatedUser(r)
+	webhook, err := app.core.GetWebhook(r.Context(), user.ID, webhookId)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.NoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.internalErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+func validateWebhook(ctx context.Context, v *validator.Validator, rawURL string, eventList []string) {
+	v.CheckNotBlank(rawURL, "url", "must be provided")
+	if parsed, err := url.Parse(rawURL); rawURL != "" && (err != nil || parsed.Host == "" ||
+		(parsed.Scheme != "http" && parsed.Scheme != "https")) {
+		v.AddError("url", "must be an absolute http or https URL")
+	} else if rawURL != "" {
+		// the sender checks the address again when it connects
+		switch err := webhooks.CheckURL(ctx, rawURL); {
+		case errors.Is(err, webhooks.ErrForbiddenAddress):
+			v.AddError("url", "must not point to a local, private or reserved address")
+		case err != nil:
+			v.AddError("url", "host could not be resolved")
+		}
+	}
+
+	for _, event := range eventList {
+		v.Check(slices.Contains(webhookEvents, event), "events", "must only contain "+strings.Join(webhookEvents, ", "))
+	}
+	v.Check(v.IsUnique(eventList), "events", "must not contain duplicates")
+}
+
+// handleWebhookEvent is the event bus subscriber that queues a delivery for every webhook interested in the event.
+func (app *application) handleWebhookEvent(ctx context.Context, event events.Event) error {
+	if !slices.Contains(webhookEvents, string(event.Type)) {
+		return nil
+	}
+
+	_, err := app.processOnce(ctx, "webhooks", event, func(txCtx context.Context) error {
+		ownerId, data, err := app.webhookData(txCtx, event)
+		if err != nil {
+			// the article or comment was deleted before the event was dispatched, there is nothing to deliver
+			return ignoreNotFound(err)
+		}
+
+		payload, err := json.Marshal(WebhookPayload{
+			Event:      string(event.Type),
+			OccurredAt: event.OccurredAt,
+			Data:       data,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = app.core.EnqueueWebhookDeliveries(txCtx, ownerId, string(event.Type), payload)
+		return err
+	})
+	return err
+}
+
+// webhookData returns the payload data of the event and the user whose webhooks should receive it.
+func (app *application) webhookData(ctx context.Context, event events.Event) (int64, envelope, error) {
+	if event.Type == events.ArticleDeleted {
+		return event.ActorID, envelope{"article": WebhookArticle{Slug: event.ArticleSlug}}, nil
+	}
+
+	article, err := app.core.GetArticleById(ctx, event.ArticleID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	author, err := app.core.GetUsersById(ctx, article.AuthorID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if event.Type == events.CommentCreated {
+		comment, err := app.core.GetCommentById(ctx, event.CommentID)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		commenter, err := app.core.GetUsersById(ctx, comment.AuthorID)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return article.AuthorID, envelope{
+			"article": WebhookArticle{Slug: article.Slug, Title: article.Title, Author: author.Username},
+			"comment": WebhookComment{
+				ID:        comment.ID,
+				Body:      comment.Body,
+				Author:    commenter.Username,
+				CreatedAt: comment.CreatedAt,
+			},
+		}, nil
+	}
+
+	tagsByArticleId, err := app.core.GetTagsByArticleId(ctx, []int64{article.ID})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tagList := []string{}
+	for _, tag := range tagsByArticleId[article.ID] {
+		tagList = append(tagList, tag.DisplayName)
+	}
+
+	data := envelope{"article": WebhookArticle{
+		Slug:        article.Slug,
+		Title:       article.Title,
+		Description: article.Description,
+		Body:        article.Body,
+		TagList:     tagList,
+		Author:      author.Username,
+		CreatedAt:   article.CreatedAt,
+		UpdatedAt:   article.UpdatedAt,
+	}}
+
+	// a co-author may have made the edit rather than the author
+	if event.Type == events.ArticleUpdated {
+		editor, err := app.core.GetUsersById(ctx, event.ActorID)
+		if err != nil {
+			return 0, nil, err
+		}
+		data["editor"] = editor.Username
+	}
+
+	return article.AuthorID, data, nil
+}
+
+// runWebhookDispatcher sends the due webhook deliveries until ctx is cancelled.
+func (app *application) runWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(app.config.WebhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.dispatchWebhooks(ctx)
+		}
+	}
+}
+
+func (app *application) dispatchWebhooks(ctx context.Context) {
+	// a claimed delivery isn't picked up again before its attempt had the time to finish
+	lease := 2 * app.config.WebhookTimeout
+
+	for {
+		deliveries, err := app.core.ClaimDueWebhookDeliveries(ctx, webhookBatchSize, lease)
+		if err != nil {
+			app.logger.Error("failed to claim webhook deliveries", "error", err.Error())
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				app.deliverWebhook(ctx, delivery)
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (app *application) deliverWebhook(ctx context.Context, delivery *core.DueWebhookDelivery) {
+	sendCtx, cancel := context.WithTimeout(ctx, app.config.WebhookTimeout)
+	defer cancel()
+
+	result := app.webhookSender.Send(sendCtx, webhooks.Delivery{
+		ID:      delivery.ID,
+		Event:   delivery.Event,
+		URL:     delivery.URL,
+		Secret:  delivery.Secret,
+		Payload: delivery.Payload,
+	})
+
+	// the outcome is recorded even when shutting down, otherwise the attempt is lost
+	recordCtx := context.WithoutCancel(ctx)
+
+	if result.Err == nil {
+		err := app.session.DoTransactionally(recordCtx, func(txCtx context.Context) error {
+			return app.core.MarkWebhookDeliverySucceeded(txCtx, delivery, result.StatusCode)
+		})
+		if err != nil {
+			app.logger.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err.Error())
+		}
+		return
+	}
+
+	policy := webhooks.Policy{
+		MaxAttempts:  app.config.WebhookMaxAttempts,
+		DisableAfter: app.config.WebhookDisableAfterFailures,
+	}
+	retryAt := policy.RetryAt(time.Now(), delivery.Attempts)
+
+	disabled, err := databaseutils.DoTransactionally(recordCtx, app.session, func(txCtx context.Context) (bool, error) {
+		return app.core.MarkWebhookDeliveryFailed(txCtx, delivery, result.StatusCode, result.Err, retryAt, policy)
+	})
+	if err != nil {
+		app.logger.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err.Error())
+		return
+	}
+
+	app.logger.Warn("webhook delivery failed", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID,
+		"attempt", delivery.Attempts, "error", result.Err.Error())
+	if disabled {
+		app.logger.Warn("webhook disabled after repeated failures", "webhook_id", delivery.WebhookID)
+	}
+}
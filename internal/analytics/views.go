@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/utils/collectionutils"
+	"github.com/siahsang/blog/models"
+)
+
+// maxReferrerLength bounds the stored referrer host, which comes from a request header.
+const maxReferrerLength = 255
+
+type viewCountKey struct {
+	articleId int64
+	day       time.Time
+	referrer  string
+}
+
+type seenView struct {
+	articleId int64
+	viewer    string
+}
+
+// ViewCounter counts the views of articles in memory until they are drained into the database, so
+// reading an article doesn't write to it. A viewer counts once per article within the window. Viewers
+// are only remembered by this instance, so a viewer whose requests reach several instances is counted
+// by each of them.
+type ViewCounter struct {
+	mutex   sync.Mutex
+	seen    *collectionutils.SafeMap[seenView, struct{}]
+	pending map[viewCountKey]int64
+	secret  []byte
+}
+
+// NewViewCounter creates a counter remembering up to maxViewers recent views for window each.
+func NewViewCounter(window time.Duration, maxViewers int) (*ViewCounter, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return &ViewCounter{
+		seen:    collectionutils.NewBounded[seenView, struct{}](maxViewers, window),
+		pending: make(map[viewCountKey]int64),
+		secret:  secret,
+	}, nil
+}
+
+// UserViewer identifies a signed-in viewer.
+func (counter *ViewCounter) UserViewer(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+// AnonymousViewer identifies an anonymous viewer by a hash of the address and user agent. The hash is
+// keyed with a secret that never leaves the process, so it can't be reversed by hashing every address.
+func (counter *ViewCounter) AnonymousViewer(address, userAgent string) string {
+	mac := hmac.New(sha256.New, counter.secret)
+	mac.Write([]byte(address + "\x00" + userAgent))
+	return "anonymous:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Record counts a view of the article by the viewer, unless the viewer has viewed it within the window.
+// It reports whether the view was counted.
+func (counter *ViewCounter) Record(articleId int64, viewer string, referrer string, now time.Time) bool {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	key := seenView{articleId: articleId, viewer: viewer}
+	if _, ok := counter.seen.Get(key); ok {
+		return false
+	}
+	counter.seen.Store(key, struct{}{})
+
+	year, month, day := now.UTC().Date()
+	counter.pending[viewCountKey{
+		articleId: articleId,
+		day:       time.Date(year, month, day, 0, 0, 0, 0, time.UTC),
+		referrer:  referrer,
+	}]++
+	return true
+}
+
+// Drain returns the views counted since the last drain and starts counting anew.
+func (counter *ViewCounter) Drain() []models.ArticleViews {
+	counter.mutex.Lock()
+	pending := counter.pending
+	counter.pending = make(map[viewCountKey]int64)
+	counter.mutex.Unlock()
+
+	views := make([]models.ArticleViews, 0, len(pending))
+	for key, count := range pending {
+		views = append(views, models.ArticleViews{ArticleID: key.articleId, Day: key.day, Referrer: key.referrer, Views: count})
+	}
+	return views
+}
+
+// Restore puts drained views that could not be saved back, to be saved with the next drain.
+func (counter *ViewCounter) Restore(views []models.ArticleViews) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	for _, view := range views {
+		counter.pending[viewCountKey{articleId: view.ArticleID, day: view.Day, referrer: view.Referrer}] += view.Views
+	}
+}
+
+// ReferrerHost reduces a Referer header to the host it names, without a "www." prefix. Views referred by
+// the site itself, or by anything but a web page, count as direct and get an empty referrer.
+func ReferrerHost(referer string, siteHost string) string {
+	parsed, err := url.Parse(referer)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	if host == "" || host == strings.TrimPrefix(strings.ToLower(siteHost), "www.") || len(host) > maxReferrerLength {
+		return ""
+	}
+	return host
+}
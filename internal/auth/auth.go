@@ -3,10 +3,12 @@ package auth
 import (
 	"errors"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/utils/collectionutils"
 	"github.com/siahsang/blog/internal/web"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -19,6 +21,10 @@ const (
 var (
 	NotAuthenticatesUser        = xerrors.Message("Not authenticated user")
 	NotAuthorizeToDeleteComment = xerrors.Message("User not authorize to delete this comment")
+	NotAuthorizeToChangeArticle = xerrors.Message("User not authorize to change this article")
+	NotAuthorizeToDeleteArticle = xerrors.Message("User not authorize to delete this article")
+	NotAuthorizeToChangeAuthors = xerrors.Message("User not authorize to change the authors of this article")
+	NotAuthorizeToChangeSeries  = xerrors.Message("User not authorize to change this series")
 )
 
 func (user *User) SetPassword(plainTextPassword string) error {
@@ -47,6 +53,7 @@ func (user *User) IsPasswordMatch(plainTextPassword string) (bool, error) {
 func (user *User) GenerateToken(duration time.Duration, JWTSecret string) (string, error) {
 	expireAt := time.Now().Add(duration)
 	claim := UserClaim{
+		UserID:   user.ID,
 		Username: user.Username,
 		Email:    user.Email,
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -96,8 +103,33 @@ func (auth *Auth) SetAuthenticatedUser(r *http.Request, user *User) *http.Reques
 	return web.AddValueToContext(r, UserCtxKey, user)
 }
 
+// CacheAuthenticatedUser keeps a copy of the user so the next requests carrying a token for
+// the same user don't have to load it from the database.
 func (auth *Auth) CacheAuthenticatedUser(user *User) {
-	auth.authenticatedUsers.Store(user.Username, user)
+	cachedUser := *user
+	cachedUser.Token = ""
+	auth.authenticatedUsers.Store(user.ID, &cachedUser)
+}
+
+// GetCachedUser returns a copy of the cached user, so callers are free to modify it.
+func (auth *Auth) GetCachedUser(userId int64) (*User, bool) {
+	cachedUser, ok := auth.authenticatedUsers.Get(userId)
+	if !ok {
+		return nil, false
+	}
+
+	user := *cachedUser
+	return &user, true
+}
+
+// InvalidateCachedUser must be called whenever the stored user changes, e.g. profile, password or
+// role updates, or account deletion.
+func (auth *Auth) InvalidateCachedUser(userId int64) {
+	auth.authenticatedUsers.Delete(userId)
+}
+
+func (auth *Auth) CacheStats() collectionutils.SafeMapStats {
+	return auth.authenticatedUsers.Stats()
 }
 
 func (auth *Auth) IsUserAuthenticated(r *http.Request) bool {
@@ -112,3 +144,34 @@ func (auth *Auth) CheckUserCanDeleteComment(user *User, commentId int64) error {
 		return xerrors.New(NotAuthorizeToDeleteComment)
 	}
 }
+
+// CheckUserCanChangeArticle lets the author and the co-authors of the article edit it.
+func (auth *Auth) CheckUserCanChangeArticle(user *User, authorId int64, coAuthorIds []int64) error {
+	if user != nil && (user.ID == authorId || slices.Contains(coAuthorIds, user.ID)) {
+		return nil
+	}
+	return xerrors.New(NotAuthorizeToChangeArticle)
+}
+
+// CheckUserCanDeleteArticle lets only the author delete the article, co-authors can't.
+func (auth *Auth) CheckUserCanDeleteArticle(user *User, authorId int64) error {
+	if user != nil && user.ID == authorId {
+		return nil
+	}
+	return xerrors.New(NotAuthorizeToDeleteArticle)
+}
+
+// CheckUserCanChangeAuthors lets only the author invite and remove co-authors.
+func (auth *Auth) CheckUserCanChangeAuthors(user *User, authorId int64) error {
+	if user != nil && user.ID == authorId {
+		return nil
+	}
+	return xerrors.New(NotAuthorizeToChangeAuthors)
+}
+
+func (auth *Auth) CheckUserCanChangeSeries(user *User, authorId int64) error {
+	if user != nil && user.ID == authorId {
+		return nil
+	}
+	return xerrors.New(NotAuthorizeToChangeSeries)
+}
@@ -1,23 +1,29 @@
 package auth
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/siahsang/blog/internal/utils/collectionutils"
 	"github.com/siahsang/blog/internal/utils/config"
 )
 
 type User struct {
-	ID                int64   `json:"-"`
-	Email             string  `json:"email"`
-	Token             string  `json:"token,omitempty"`
-	Username          string  `json:"username"`
-	Password          []byte  `json:"-"`
-	PlaintextPassword string  `json:"-"`
-	Bio               *string `json:"bio"`
-	Image             *string `json:"image"`
+	ID                int64      `json:"-"`
+	Email             string     `json:"email"`
+	Token             string     `json:"token,omitempty"`
+	Username          string     `json:"username"`
+	Password          []byte     `json:"-"`
+	PlaintextPassword string     `json:"-"`
+	Bio               *string    `json:"bio"`
+	Image             *string    `json:"image"`
+	IsPrivate         bool       `json:"private"`
+	IsAdmin           bool       `json:"-"`
+	DeletedAt         *time.Time `json:"-"`
 }
 
 type UserClaim struct {
+	UserID   int64  `json:"uid,omitempty"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 
@@ -25,12 +31,13 @@ type UserClaim struct {
 }
 
 type Auth struct {
-	authenticatedUsers *collectionutils.SafeMap[string, *User]
+	authenticatedUsers *collectionutils.SafeMap[int64, *User]
 	config             *config.Config
 }
 
 func New(config *config.Config) *Auth {
 	return &Auth{
-		config: config,
+		authenticatedUsers: collectionutils.NewBounded[int64, *User](config.UserCacheSize, config.UserCacheTTL),
+		config:             config,
 	}
 }
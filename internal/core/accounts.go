@@ -0,0 +1,326 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/utils/collectionutils"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/functional"
+	"github.com/siahsang/blog/models"
+)
+
+// Article policies a user can choose when deleting the account.
+const (
+	ArticlePolicyAnonymize = "anonymize"
+	ArticlePolicyRemove    = "remove"
+)
+
+var (
+	ErrInvalidArticlePolicy = xerrors.Message("Invalid article policy")
+	ErrAccountNotDeleted    = xerrors.Message("Account is not scheduled for deletion")
+)
+
+func IsValidArticlePolicy(policy string) bool {
+	return policy == ArticlePolicyAnonymize || policy == ArticlePolicyRemove
+}
+
+// ExportUserData collects everything we store about the user: profile, articles, comments,
+// favorites and follow relations.
+func (c *Core) ExportUserData(ctx context.Context, user *auth.User) (*models.UserDataExport, error) {
+	export := &models.UserDataExport{
+		ExportedAt: time.Now(),
+		Profile: models.ExportedProfile{
+			Username: user.Username,
+			Email:    user.Email,
+			Bio:      user.Bio,
+			Image:    user.Image,
+		},
+	}
+
+	articles, err := c.exportArticles(ctx, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	export.Articles = articles
+
+	const commentsSQL = `
+		SELECT c.id, a.slug, c.body, c.created_at, c.updated_at
+		FROM comments AS c
+		    JOIN articles AS a ON c.article_id = a.id
+		WHERE c.author_id = $1
+		ORDER BY c.created_at
+	`
+	export.Comments, err = databaseutils.ExecuteQuery(c.sqlTemplate, ctx, commentsSQL, func(rows *sql.Rows) (models.ExportedComment, error) {
+		var comment models.ExportedComment
+		if err := rows.Scan(&comment.ID, &comment.ArticleSlug, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt); err != nil {
+			return comment, xerrors.New(err)
+		}
+		return comment, nil
+	}, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const favoritesSQL = `
+		SELECT a.slug, a.title
+		FROM favourite_articles AS fa
+		    JOIN articles AS a ON fa.article_id = a.id
+		WHERE fa.user_id = $1
+		ORDER BY a.slug
+	`
+	export.Favorites, err = databaseutils.ExecuteQuery(c.sqlTemplate, ctx, favoritesSQL, func(rows *sql.Rows) (models.ExportedFavorite, error) {
+		var favorite models.ExportedFavorite
+		if err := rows.Scan(&favorite.ArticleSlug, &favorite.ArticleTitle); err != nil {
+			return favorite, xerrors.New(err)
+		}
+		return favorite, nil
+	}, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const bookmarksSQL = `
+		SELECT a.slug, a.title, b.created_at
+		FROM bookmarks AS b
+		    JOIN articles AS a ON b.article_id = a.id
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC
+	`
+	export.Bookmarks, err = databaseutils.ExecuteQuery(c.sqlTemplate, ctx, bookmarksSQL, func(rows *sql.Rows) (models.ExportedBookmark, error) {
+		var bookmark models.ExportedBookmark
+		if err := rows.Scan(&bookmark.ArticleSlug, &bookmark.ArticleTitle, &bookmark.BookmarkedAt); err != nil {
+			return bookmark, xerrors.New(err)
+		}
+		return bookmark, nil
+	}, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const followingSQL = `
+		SELECT u.username
+		FROM followers AS f
+		    JOIN users AS u ON f.user_id = u.id
+		WHERE f.follower_id = $1
+		ORDER BY u.username
+	`
+	export.Following, err = databaseutils.ExecuteQuery(c.sqlTemplate, ctx, followingSQL, scanString, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const followersSQL = `
+		SELECT u.username
+		FROM followers AS f
+		    JOIN users AS u ON f.follower_id = u.id
+		WHERE f.user_id = $1
+		ORDER BY u.username
+	`
+	export.Followers, err = databaseutils.ExecuteQuery(c.sqlTemplate, ctx, followersSQL, scanString, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return export, nil
+}
+
+func (c *Core) exportArticles(ctx context.Context, authorId int64) ([]models.ExportedArticle, error) {
+	const selectSQL = `
+		SELECT id, slug, title, description, body, created_at, updated_at
+		FROM articles
+		WHERE author_id = $1
+		ORDER BY created_at
+	`
+
+	type QueryResult struct {
+		ID      int64
+		Article models.ExportedArticle
+	}
+
+	queryResultList, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (QueryResult, error) {
+		var qr QueryResult
+		if err := rows.Scan(&qr.ID, &qr.Article.Slug, &qr.Article.Title, &qr.Article.Description,
+			&qr.Article.Body, &qr.Article.CreatedAt, &qr.Article.UpdatedAt); err != nil {
+			return qr, xerrors.New(err)
+		}
+		return qr, nil
+	}, authorId)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	tagsByArticleId, err := c.GetTagsByArticleId(ctx, functional.Map(queryResultList, func(qr QueryResult) int64 {
+		return qr.ID
+	}))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return functional.Map(queryResultList, func(qr QueryResult) models.ExportedArticle {
+		tags := collectionutils.GetOrDefault(tagsByArticleId, qr.ID, []models.Tag{})
+		qr.Article.TagList = functional.Map(tags, func(t models.Tag) string { return t.DisplayName })
+		return qr.Article
+	}), nil
+}
+
+// ScheduleAccountDeletion soft-deletes the account. It is hidden immediately and purged by
+// PurgeAccount once purgeAfter has passed.
+func (c *Core) ScheduleAccountDeletion(ctx context.Context, userId int64, articlePolicy string, purgeAfter time.Time) (*models.AccountDeletion, error) {
+	if !IsValidArticlePolicy(articlePolicy) {
+		return nil, xerrors.New(ErrInvalidArticlePolicy)
+	}
+
+	const updateSQL = `
+		UPDATE users
+		SET deleted_at = NOW(), purge_after = $1, article_policy = $2
+		WHERE id = $3 AND NOT anonymized
+		RETURNING id, purge_after, article_policy
+	`
+
+	deletion, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, updateSQL, scanAccountDeletion, purgeAfter, articlePolicy, userId)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	c.log.Info("account scheduled for deletion", "user_id", userId, "purge_after", purgeAfter)
+	return deletion, nil
+}
+
+// RestoreAccount cancels a pending deletion while the grace period is still running.
+func (c *Core) RestoreAccount(ctx context.Context, userId int64) error {
+	const updateSQL = `
+		UPDATE users
+		SET deleted_at = NULL, purge_after = NULL, article_policy = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND purge_after > NOW()
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, userId)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.New(ErrAccountNotDeleted)
+	}
+
+	c.log.Info("account deletion cancelled", "user_id", userId)
+	return nil
+}
+
+func (c *Core) GetAccountsDueForPurge(ctx context.Context, now time.Time, limit int) ([]*models.AccountDeletion, error) {
+	const selectSQL = `
+		SELECT id, purge_after, article_policy
+		FROM users
+		WHERE deleted_at IS NOT NULL AND purge_after <= $1
+		ORDER BY purge_after
+		LIMIT $2
+	`
+
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanAccountDeletion, now, limit)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// PurgeAccount permanently removes a soft-deleted account. Depending on the chosen policy the
+// articles are either removed with the account or kept under an anonymized placeholder user.
+// It is expected to run inside a transaction.
+func (c *Core) PurgeAccount(ctx context.Context, deletion *models.AccountDeletion) error {
+	if deletion.ArticlePolicy == ArticlePolicyRemove {
+		const deleteSQL = `
+			DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL
+		`
+		// the articles go away with the user, collect them first so their deletion is announced
+		const selectArticlesSQL = `
+			SELECT id, slug FROM articles WHERE author_id = $1
+		`
+		removedArticles, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectArticlesSQL, func(rows *sql.Rows) (*models.Article, error) {
+			article := &models.Article{AuthorID: deletion.UserID}
+			if err := rows.Scan(&article.ID, &article.Slug); err != nil {
+				return nil, xerrors.New(err)
+			}
+			return article, nil
+		}, deletion.UserID)
+		if err != nil {
+			return xerrors.New(err)
+		}
+
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, deletion.UserID); err != nil {
+			return xerrors.New(err)
+		}
+
+		for _, article := range removedArticles {
+			if err := c.emit(ctx, events.Event{
+				Type:        events.ArticleDeleted,
+				ActorID:     article.AuthorID,
+				ArticleID:   article.ID,
+				ArticleSlug: article.Slug,
+			}); err != nil {
+				return err
+			}
+		}
+
+		c.log.Info("account purged", "user_id", deletion.UserID, "articles", deletion.ArticlePolicy)
+		return nil
+	}
+
+	statements := []string{
+		`DELETE FROM comments WHERE author_id = $1`,
+		`DELETE FROM favourite_articles WHERE user_id = $1`,
+		`DELETE FROM bookmarks WHERE user_id = $1`,
+		`DELETE FROM article_reactions WHERE user_id = $1`,
+		`DELETE FROM comment_reactions WHERE user_id = $1`,
+		`DELETE FROM article_authors WHERE user_id = $1`,
+		`DELETE FROM webhooks WHERE user_id = $1`,
+		`DELETE FROM tag_follows WHERE user_id = $1`,
+		`DELETE FROM uploads WHERE user_id = $1`,
+		`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+		`UPDATE users
+		 SET username       = 'deleted-user-' || id,
+		     email          = 'deleted-user-' || id || '@users.invalid',
+		     password       = ''::bytea,
+		     bio            = NULL,
+		     image          = NULL,
+		     deleted_at     = NULL,
+		     purge_after    = NULL,
+		     article_policy = NULL,
+		     anonymized     = TRUE
+		 WHERE id = $1`,
+	}
+
+	for _, statement := range statements {
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, statement, deletion.UserID); err != nil {
+			return xerrors.New(err)
+		}
+	}
+
+	c.log.Info("account purged", "user_id", deletion.UserID, "articles", deletion.ArticlePolicy)
+	return nil
+}
+
+func scanAccountDeletion(rows *sql.Rows) (*models.AccountDeletion, error) {
+	deletion := &models.AccountDeletion{}
+	if err := rows.Scan(&deletion.UserID, &deletion.PurgeAfter, &deletion.ArticlePolicy); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return deletion, nil
+}
+
+func scanString(rows *sql.Rows) (string, error) {
+	var value string
+	if err := rows.Scan(&value); err != nil {
+		return "", xerrors.New(err)
+	}
+	return value, nil
+}
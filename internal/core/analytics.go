@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// AddArticleViews adds counted views to the daily views of the articles and their referrers. Views of
+// articles deleted since they were counted are dropped.
+func (c *Core) AddArticleViews(ctx context.Context, views []models.ArticleViews) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	var (
+		articleIds = make([]int64, 0, len(views))
+		days       = make([]string, 0, len(views))
+		referrers  = make([]string, 0, len(views))
+		counts     = make([]int64, 0, len(views))
+	)
+	for _, view := range views {
+		articleIds = append(articleIds, view.ArticleID)
+		days = append(days, view.Day.Format(time.DateOnly))
+		referrers = append(referrers, view.Referrer)
+		counts = append(counts, view.Views)
+	}
+
+	statements := []string{`
+		INSERT INTO article_daily_views (article_id, day, views)
+		SELECT v.article_id, v.day, SUM(v.views)
+		FROM unnest($1::bigint[], $2::date[], $3::text[], $4::bigint[]) AS v(article_id, day, referrer, views)
+		WHERE EXISTS (SELECT 1 FROM articles AS a WHERE a.id = v.article_id)
+		GROUP BY v.article_id, v.day
+		ON CONFLICT (article_id, day) DO UPDATE SET views = article_daily_views.views + EXCLUDED.views
+	`, `
+		INSERT INTO article_referrers (article_id, day, referrer, views)
+		SELECT v.article_id, v.day, v.referrer, SUM(v.views)
+		FROM unnest($1::bigint[], $2::date[], $3::text[], $4::bigint[]) AS v(article_id, day, referrer, views)
+		WHERE v.referrer <> '' AND EXISTS (SELECT 1 FROM articles AS a WHERE a.id = v.article_id)
+		GROUP BY v.article_id, v.day, v.referrer
+		ON CONFLICT (article_id, day, referrer) DO UPDATE SET views = article_referrers.views + EXCLUDED.views
+	`}
+	for _, statement := range statements {
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, statement,
+			pq.Array(articleIds), pq.Array(days), pq.Array(referrers), pq.Array(counts)); err != nil {
+			return xerrors.New(err)
+		}
+	}
+
+	return nil
+}
+
+// GetArticleStats returns the daily views, favorites and comments of the articles of the author between
+// from and to, both days (UTC) included. Articles without any activity in the range are left out.
+func (c *Core) GetArticleStats(ctx context.Context, authorId int64, from time.Time, to time.Time) ([]*models.ArticleStats, error) {
+	const selectSQL = `
+		WITH activity AS (
+			SELECT vw.article_id, vw.day, vw.views, 0 AS favorites, 0 AS comments
+			FROM article_daily_views AS vw
+			WHERE vw.day BETWEEN $2::date AND $3::date
+			UNION ALL
+			SELECT fa.article_id, (fa.created_at AT TIME ZONE 'UTC')::date, 0, 1, 0
+			FROM favourite_articles AS fa
+			WHERE fa.created_at >= $4 AND fa.created_at < $5
+			UNION ALL
+			SELECT cm.article_id, (cm.created_at AT TIME ZONE 'UTC')::date, 0, 0, 1
+			FROM comments AS cm
+			WHERE cm.created_at >= $4 AND cm.created_at < $5
+		)
+		SELECT a.id, a.slug, a.title, ac.day, SUM(ac.views), SUM(ac.favorites), SUM(ac.comments)
+		FROM activity AS ac
+		    JOIN articles AS a ON a.id = ac.article_id
+		WHERE a.author_id = $1
+		GROUP BY a.id, a.slug, a.title, ac.day
+		ORDER BY a.created_at DESC, a.id, ac.day
+	`
+
+	type dailyRow struct {
+		articleId int64
+		slug      string
+		title     string
+		day       time.Time
+		stats     models.DailyStats
+	}
+
+	rows, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*dailyRow, error) {
+		row := &dailyRow{}
+		if err := rows.Scan(&row.articleId, &row.slug, &row.title, &row.day,
+			&row.stats.Views, &row.stats.Favorites, &row.stats.Comments); err != nil {
+			return nil, xerrors.New(err)
+		}
+		row.stats.Date = row.day.Format(time.DateOnly)
+		return row, nil
+	}, authorId, from.Format(time.DateOnly), to.Format(time.DateOnly), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	// rows of an article are adjacent, so a new article starts whenever the id changes
+	articleStats := []*models.ArticleStats{}
+	var lastArticleId int64
+	for _, row := range rows {
+		if len(articleStats) == 0 || row.articleId != lastArticleId {
+			articleStats = append(articleStats, &models.ArticleStats{Slug: row.slug, Title: row.title, Days: []models.DailyStats{}})
+			lastArticleId = row.articleId
+		}
+
+		stats := articleStats[len(articleStats)-1]
+		stats.Views += row.stats.Views
+		stats.Favorites += row.stats.Favorites
+		stats.Comments += row.stats.Comments
+		stats.Days = append(stats.Days, row.stats)
+	}
+
+	return articleStats, nil
+}
+
+// GetTopReferrers returns the hosts that referred the most views to the articles of the author between
+// from and to, both days (UTC) included.
+func (c *Core) GetTopReferrers(ctx context.Context, authorId int64, from time.Time, to time.Time, limit int) ([]*models.ReferrerStats, error) {
+	const selectSQL = `
+		SELECT rf.referrer, SUM(rf.views) AS views
+		FROM article_referrers AS rf
+		    JOIN articles AS a ON a.id = rf.article_id
+		WHERE a.author_id = $1 AND rf.day BETWEEN $2::date AND $3::date
+		GROUP BY rf.referrer
+		ORDER BY views DESC, rf.referrer
+		LIMIT $4
+	`
+
+	referrers, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*models.ReferrerStats, error) {
+		referrer := &models.ReferrerStats{}
+		if err := rows.Scan(&referrer.Referrer, &referrer.Views); err != nil {
+			return nil, xerrors.New(err)
+		}
+		return referrer, nil
+	}, authorId, from.Format(time.DateOnly), to.Format(time.DateOnly), limit)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return referrers, nil
+}
+
+// GetFollowerGrowth returns how the followers of the user grew between from and to, both days (UTC)
+// included. An unfollow removes the follow, so the growth is that of the current followers.
+func (c *Core) GetFollowerGrowth(ctx context.Context, userId int64, from time.Time, to time.Time) (*models.FollowerGrowth, error) {
+	const startSQL = `
+		SELECT COUNT(*)
+		FROM followers AS f
+		WHERE f.user_id = $1 AND (f.created_at IS NULL OR f.created_at < $2)
+	`
+	start, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, startSQL, scanInt64, userId, from)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const daysSQL = `
+		SELECT (f.created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*)
+		FROM followers AS f
+		WHERE f.user_id = $1 AND f.created_at >= $2 AND f.created_at < $3
+		GROUP BY day
+		ORDER BY day
+	`
+	days, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, daysSQL, func(rows *sql.Rows) (models.DailyFollowers, error) {
+		var (
+			day       time.Time
+			followers models.DailyFollowers
+		)
+		if err := rows.Scan(&day, &followers.Gained); err != nil {
+			return models.DailyFollowers{}, xerrors.New(err)
+		}
+		followers.Date = day.Format(time.DateOnly)
+		return followers, nil
+	}, userId, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	growth := &models.FollowerGrowth{Start: start, End: start, Days: []models.DailyFollowers{}}
+	for _, day := range days {
+		growth.End += day.Gained
+		day.Total = growth.End
+		growth.Days = append(growth.Days, day)
+	}
+
+	return growth, nil
+}
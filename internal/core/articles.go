@@ -3,13 +3,18 @@ package core
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/mdobak/go-xerrors"
 	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/events"
 	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/markdown"
+	"github.com/siahsang/blog/internal/tagging"
 	"github.com/siahsang/blog/internal/utils/databaseutils"
 	"github.com/siahsang/blog/internal/utils/stringutils"
 	"github.com/siahsang/blog/models"
@@ -18,22 +23,38 @@ import (
 var ErrDuplicatedSlug = xerrors.Message("Duplicate slug")
 var ErrDuplicatedArticleTag = xerrors.Message("Duplicate article tag")
 
-func (c *Core) CreateArticle(context context.Context, article *models.Article, tagModels []*models.Tag) (*models.Article, error) {
+// Slugs of fixed paths under /api/articles, which articles can't have.
+const (
+	TrendingSlug = "trending"
+	FeedSlug     = "feed"
+)
+
+var reservedSlugs = []string{TrendingSlug, FeedSlug}
+
+// articleColumns are the columns scanArticle reads, with the articles table aliased as "a".
+const articleColumns = `a.id, a.slug, a.title, a.description, a.body, a.created_at, a.updated_at, a.author_id,
+		a.word_count, a.reading_time_minutes, a.excerpt, a.cover_image`
 
+func scanArticle(rows *sql.Rows) (*models.Article, error) {
+	var article = &models.Article{}
+	if err := rows.Scan(&article.ID, &article.Slug, &article.Title, &article.Description, &article.Body,
+		&article.CreatedAt, &article.UpdatedAt, &article.AuthorID,
+		&article.WordCount, &article.ReadingTimeMinutes, &article.Excerpt, &article.CoverImage); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return article, nil
+}
+
+func (c *Core) CreateArticle(context context.Context, article *models.Article, tagModels []*models.Tag) (*models.Article, error) {
+	summary := markdown.Summarize(article.Body)
 	insertSQL := `
-		INSERT INTO articles (slug,title,description,body,created_at,updated_at,author_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id,slug,title,description,body,created_at,updated_at,author_id
-	`
+		INSERT INTO articles AS a (slug,title,description,body,created_at,updated_at,author_id,word_count,reading_time_minutes,excerpt,cover_image)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING ` + articleColumns
 
-	newArticle, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, insertSQL, func(rows *sql.Rows) (*models.Article, error) {
-		var article models.Article
-		if err := rows.Scan(&article.ID, &article.Slug, &article.Title,
-			&article.Description, &article.Body, &article.CreatedAt, &article.UpdatedAt, &article.AuthorID); err != nil {
-			return nil, xerrors.New(err)
-		}
-		return &article, nil
-	}, article.Slug, article.Title, article.Description, article.Body, time.Now(), time.Now(), article.AuthorID)
+	newArticle, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, insertSQL, scanArticle,
+		article.Slug, article.Title, article.Description, article.Body, time.Now(), time.Now(), article.AuthorID,
+		summary.WordCount, summary.ReadingTimeMinutes, summary.Excerpt, article.CoverImage)
 
 	if err != nil {
 		switch {
@@ -78,6 +99,17 @@ func (c *Core) CreateArticle(context context.Context, article *models.Article, t
 		}
 	}
 
+	// articles have no draft state yet, so they are published as soon as they are created
+	for _, eventType := range []events.Type{events.ArticleCreated, events.ArticlePublished} {
+		if err := c.emit(context, events.Event{
+			Type:      eventType,
+			ActorID:   newArticle[0].AuthorID,
+			ArticleID: newArticle[0].ID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	return newArticle[0], nil
 }
 
@@ -221,20 +253,38 @@ func (c *Core) CreateSlug(title string) string {
 
 	slug = strings.Trim(slug, "-")
 
+	// the article would be hidden behind the fixed path
+	if slices.Contains(reservedSlugs, slug) {
+		slug += "-article"
+	}
+
 	return slug
 }
 
-func (c *Core) GetArticles(context context.Context, filter filter.Filter, tag, authorUserName, favoritedBy string) ([]*models.Article, error) {
+// ArticleCriteria narrows down the articles returned by GetArticles. Empty fields are ignored.
+type ArticleCriteria struct {
+	Tag            string
+	AuthorUserName string
+	FavoritedBy    string
+	// FollowedBy keeps the articles of the authors this user follows.
+	FollowedBy *auth.User
+	// WithFollowedTags widens FollowedBy to the articles tagged with a tag the user follows, the personal feed.
+	WithFollowedTags bool
+	// Viewer is the user the list is built for. Articles by authors the viewer has muted are left out.
+	Viewer *auth.User
+}
+
+func (c *Core) GetArticles(context context.Context, filter filter.Filter, criteria ArticleCriteria) ([]*models.Article, error) {
 	var favoritedById *int64
-	if strings.TrimSpace(favoritedBy) != "" {
-		user, err := c.GetUserByUsername(context, favoritedBy)
+	if strings.TrimSpace(criteria.FavoritedBy) != "" {
+		user, err := c.GetUserByUsername(context, criteria.FavoritedBy)
 		if err == nil {
 			favoritedById = &user.ID
 		}
 	}
 
 	selectSQL := `
-		SELECT DISTINCT a.id,a.slug,a.title,a.description,a.body,a.created_at,a.updated_at,a.author_id
+		SELECT DISTINCT ` + articleColumns + `
 		FROM articles AS a 
 		    LEFT JOIN articles_tags at ON a.id = at.article_id 
 		    LEFT JOIN tags t ON at.tag_id = t.id 
@@ -242,19 +292,23 @@ func (c *Core) GetArticles(context context.Context, filter filter.Filter, tag, a
 		    LEFT JOIN users AS u ON a.author_id = u.id     
 	`
 
-	whereClause := []string{}
+	// accounts pending deletion are hidden together with their articles
+	whereClause := []string{" u.deleted_at IS NULL"}
 	args := []any{}
 	argId := 1
 
-	if tag != "" {
-		whereClause = append(whereClause, " t.name = $"+fmt.Sprintf("%d", argId))
-		args = append(args, tag)
+	if criteria.Tag != "" {
+		// an alias finds the articles of its tag
+		whereClause = append(whereClause, fmt.Sprintf(" (t.name = $%[1]d OR t.id = (SELECT ta.tag_id FROM tag_aliases AS ta WHERE ta.alias = $%[1]d))", argId))
+		args = append(args, tagging.Normalize(criteria.Tag))
 		argId++
 	}
 
-	if authorUserName != "" {
-		whereClause = append(whereClause, " u.username = $"+fmt.Sprintf("%d", argId))
-		args = append(args, authorUserName)
+	if criteria.AuthorUserName != "" {
+		// co-authors find the article as well as its author
+		whereClause = append(whereClause, fmt.Sprintf(` (u.username = $%[1]d OR a.id IN (SELECT aa.article_id FROM article_authors AS aa
+			JOIN users AS au ON au.id = aa.user_id WHERE au.username = $%[1]d AND au.deleted_at IS NULL AND aa.accepted_at IS NOT NULL))`, argId))
+		args = append(args, criteria.AuthorUserName)
 		argId++
 	}
 
@@ -264,22 +318,35 @@ func (c *Core) GetArticles(context context.Context, filter filter.Filter, tag, a
 		argId++
 	}
 
-	if len(whereClause) > 0 {
-		selectSQL += " WHERE " + strings.Join(whereClause, " AND ")
+	if criteria.FollowedBy != nil {
+		followedClause := fmt.Sprintf("a.author_id IN (SELECT f.user_id FROM followers AS f WHERE f.follower_id = $%d)", argId)
+		if criteria.WithFollowedTags {
+			followedClause = fmt.Sprintf(`(%[2]s
+			OR (a.author_id <> $%[1]d AND a.id IN (SELECT ft.article_id FROM articles_tags AS ft
+			    JOIN tag_follows AS tf ON tf.tag_id = ft.tag_id WHERE tf.user_id = $%[1]d)))`, argId, followedClause)
+		}
+		whereClause = append(whereClause, " "+followedClause)
+		args = append(args, criteria.FollowedBy.ID)
+		argId++
+	}
+
+	whereClause = append(whereClause, " "+articleVisibilityClause(fmt.Sprintf("$%d", argId)))
+	args = append(args, viewerId(criteria.Viewer))
+	argId++
+
+	if criteria.Viewer != nil {
+		whereClause = append(whereClause, " NOT EXISTS (SELECT 1 FROM user_mutes AS m WHERE m.muter_id = $"+fmt.Sprintf("%d", argId)+" AND m.muted_id = a.author_id)")
+		args = append(args, criteria.Viewer.ID)
+		argId++
 	}
 
+	selectSQL += " WHERE " + strings.Join(whereClause, " AND ")
+
 	// add limit and offset
 	selectSQL += " ORDER BY a.created_at DESC LIMIT $" + fmt.Sprintf("%d", argId) + " OFFSET $" + fmt.Sprintf("%d", argId+1)
 	args = append(args, filter.Limit, filter.Offset)
 
-	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, selectSQL, func(rows *sql.Rows) (*models.Article, error) {
-		var article = &models.Article{}
-		if err := rows.Scan(&article.ID, &article.Slug, &article.Title,
-			&article.Description, &article.Body, &article.CreatedAt, &article.UpdatedAt, &article.AuthorID); err != nil {
-			return nil, xerrors.New(err)
-		}
-		return article, nil
-	}, args...)
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, selectSQL, scanArticle, args...)
 
 	if err != nil {
 		return nil, xerrors.New(err)
@@ -288,59 +355,176 @@ func (c *Core) GetArticles(context context.Context, filter filter.Filter, tag, a
 	return result, nil
 }
 
-func (c *Core) UpdateArticle(context context.Context, article *models.Article) (*models.Article, error) {
+// UpdateArticle saves the changes of the article made by the editor, the author or a co-author.
+func (c *Core) UpdateArticle(context context.Context, article *models.Article, editor *auth.User) (*models.Article, error) {
+	summary := markdown.Summarize(article.Body)
 	query := `
-		UPDATE articles
-		SET title = $1, description = $2, body = $3, updated_at = $4
+		UPDATE articles AS a
+		SET title = $1, description = $2, body = $3, updated_at = $4, word_count = $6, reading_time_minutes = $7, excerpt = $8,
+		    cover_image = $9
 		WHERE id = $5
-		RETURNING id,slug,title,description,body,created_at,updated_at,author_id
-	`
-	args := []any{article.Title, article.Description, article.Body, time.Now(), article.ID}
-	returningArticle, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (*models.Article, error) {
-		var article = &models.Article{}
-		if err := rows.Scan(&article.ID, &article.Slug, &article.Title,
-			&article.Description, &article.Body, &article.CreatedAt, &article.UpdatedAt, &article.AuthorID); err != nil {
-			return nil, xerrors.New(err)
-		}
-		return article, nil
-	}, args...)
+		RETURNING ` + articleColumns
+	args := []any{article.Title, article.Description, article.Body, time.Now(), article.ID,
+		summary.WordCount, summary.ReadingTimeMinutes, summary.Excerpt, article.CoverImage}
+	returningArticle, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, query, scanArticle, args...)
 
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
+
+	if err := c.emit(context, events.Event{
+		Type:      events.ArticleUpdated,
+		ActorID:   editor.ID,
+		ArticleID: returningArticle.ID,
+	}); err != nil {
+		return nil, err
+	}
+
 	return returningArticle, nil
+}
+
+// DeleteArticle deletes the article together with its comments, favorites and tags, and moves the later
+// parts of its series forward.
+func (c *Core) DeleteArticle(ctx context.Context, article *models.Article) error {
+	if err := c.removeArticleFromSeries(ctx, article.ID); err != nil {
+		return err
+	}
+
+	const deleteSQL = `
+		DELETE FROM articles WHERE id = $1
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, article.ID)
+	if err != nil {
+		return xerrors.New(err)
+	}
 
+	if rowsAffected == 0 {
+		return xerrors.New(NoRecordFound)
+	}
+
+	if err := c.emit(ctx, events.Event{
+		Type:        events.ArticleDeleted,
+		ActorID:     article.AuthorID,
+		ArticleID:   article.ID,
+		ArticleSlug: article.Slug,
+	}); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func (c *Core) GetArticleBySlug(context context.Context, slug string) (*models.Article, error) {
 	selectSQL := `
-		SELECT a.id,a.slug,a.title,a.description,a.body,a.created_at,a.updated_at,a.author_id
-		FROM articles AS a 
-		WHERE a.slug = $1
+		SELECT ` + articleColumns + `
+		FROM articles AS a
+		    JOIN users AS u ON a.author_id = u.id
+		WHERE a.slug = $1 AND u.deleted_at IS NULL
 	`
 
-	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, selectSQL, func(rows *sql.Rows) (*models.Article, error) {
-		var article = &models.Article{}
-		if err := rows.Scan(&article.ID, &article.Slug, &article.Title,
-			&article.Description, &article.Body, &article.CreatedAt, &article.UpdatedAt, &article.AuthorID); err != nil {
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, selectSQL, scanArticle, slug)
+
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// GetArticleBySlugForViewer returns the article only if the viewer is allowed to see it: articles of
+// private profiles are visible to their author and approved followers only.
+func (c *Core) GetArticleBySlugForViewer(context context.Context, slug string, viewer *auth.User) (*models.Article, error) {
+	selectSQL := `
+		SELECT ` + articleColumns + `
+		FROM articles AS a
+		    JOIN users AS u ON a.author_id = u.id
+		WHERE a.slug = $1 AND u.deleted_at IS NULL AND ` + articleVisibilityClause("$2")
+
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, selectSQL, scanArticle, slug, viewerId(viewer))
+
+	if err != nil {
+		switch {
+		case errors.Is(err, databaseutils.ErrNoRowsFound):
+			return nil, xerrors.New(NoRecordFound)
+		default:
 			return nil, xerrors.New(err)
 		}
-		return article, nil
-	}, slug)
+	}
 
+	return result, nil
+}
+
+// checkArticleVisible returns NoRecordFound when the user is not allowed to see the article.
+func (c *Core) checkArticleVisible(context context.Context, articleId, userId int64) error {
+	selectSQL := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM articles AS a
+			    JOIN users AS u ON a.author_id = u.id
+			WHERE a.id = $1 AND ` + articleVisibilityClause("$2") + `
+		)
+	`
+
+	isVisible, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, selectSQL, scanBool, articleId, userId)
 	if err != nil {
-		return nil, xerrors.New(err)
+		return xerrors.New(err)
+	}
+
+	if !isVisible {
+		return xerrors.New(NoRecordFound)
+	}
+
+	return nil
+}
+
+// articleVisibilityClause restricts articles of private profiles to their author and approved followers.
+// It expects the articles table aliased as "a", the authors as "u" and the viewer id bound to placeholder.
+func articleVisibilityClause(placeholder string) string {
+	return authorVisibilityClause("a.author_id", placeholder)
+}
+
+// authorVisibilityClause restricts the content of the author in authorColumn, who is joined as "u", the
+// same way articleVisibilityClause restricts articles.
+func authorVisibilityClause(authorColumn string, placeholder string) string {
+	return fmt.Sprintf(`(NOT u.is_private OR %[1]s = %[2]s OR EXISTS (
+			SELECT 1 FROM followers AS vf WHERE vf.user_id = %[1]s AND vf.follower_id = %[2]s))`, authorColumn, placeholder)
+}
+
+func (c *Core) GetArticleById(ctx context.Context, articleId int64) (*models.Article, error) {
+	const selectSQL = `
+		SELECT ` + articleColumns + `
+		FROM articles AS a
+		WHERE a.id = $1
+	`
+
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanArticle, articleId)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, databaseutils.ErrNoRowsFound):
+			return nil, xerrors.New(NoRecordFound)
+		default:
+			return nil, xerrors.New(err)
+		}
 	}
 
 	return result, nil
 }
 
 func (c *Core) FavoriteArticle(context context.Context, slug string, user *auth.User) (*models.Article, error) {
-	article, err := c.GetArticleBySlug(context, slug)
+	article, err := c.GetArticleBySlugForViewer(context, slug, user)
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
+	if err := c.checkNotBlockedByArticleAuthor(context, article.ID, user.ID); err != nil {
+		return nil, err
+	}
+
 	const updateSQL = `
 		INSERT INTO favourite_articles (user_id, article_id)
 		VALUES ($1, $2)
@@ -348,15 +532,27 @@ func (c *Core) FavoriteArticle(context context.Context, slug string, user *auth.
 		RETURNING user_id,article_id
 	`
 
-	_, err = databaseutils.ExecuteNonQuery(c.sqlTemplate, context, updateSQL, user.ID, article.ID)
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, context, updateSQL, user.ID, article.ID)
 
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
+	if rowsAffected > 0 {
+		if err := c.emit(context, events.Event{
+			Type:      events.ArticleFavorited,
+			ActorID:   user.ID,
+			ArticleID: article.ID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	return article, nil
 }
 
+// UnFavoriteArticle removes the favorite of the user from the article, even if the user can no longer
+// see it. The returned article is not checked against the viewer.
 func (c *Core) UnFavoriteArticle(context context.Context, slug string, user *auth.User) (*models.Article, error) {
 	article, err := c.GetArticleBySlug(context, slug)
 	if err != nil {
@@ -369,11 +565,21 @@ func (c *Core) UnFavoriteArticle(context context.Context, slug string, user *aut
 		RETURNING user_id, article_id
 	`
 
-	_, err = databaseutils.ExecuteNonQuery(c.sqlTemplate, context, deleteSQL, user.ID, article.ID)
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, context, deleteSQL, user.ID, article.ID)
 
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
+
+	if rowsAffected > 0 {
+		if err := c.emit(context, events.Event{
+			Type:      events.ArticleUnfavorited,
+			ActorID:   user.ID,
+			ArticleID: article.ID,
+		}); err != nil {
+			return nil, err
+		}
+	}
 	c.log.Info("user unfavorited article", "id", user.ID, "article_id", article.ID)
 	return article, nil
 }
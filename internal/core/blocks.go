@@ -0,0 +1,204 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+var (
+	ErrBlockedByUser       = xerrors.Message("You have been blocked by this user")
+	ErrCannotBlockYourself = xerrors.Message("You cannot block or mute yourself")
+	UserIsNotBlocked       = xerrors.Message("User is not blocked")
+	UserIsNotMuted         = xerrors.Message("User is not muted")
+)
+
+// BlockUser blocks the user and removes any follow relation or request between both users. Blocked users can't
+// follow the blocker, comment on or favorite the blocker's articles.
+// It is expected to run inside a transaction.
+func (c *Core) BlockUser(ctx context.Context, blockerUser auth.User, blockedUserName string) (*models.Profile, error) {
+	blockedUser, err := c.GetUserByUsername(ctx, blockedUserName)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if blockedUser.ID == blockerUser.ID {
+		return nil, xerrors.New(ErrCannotBlockYourself)
+	}
+
+	const insertSQL = `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, blockerUser.ID, blockedUser.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const deleteFollowSQL = `
+		DELETE FROM followers
+		WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteFollowSQL, blockerUser.ID, blockedUser.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const deleteFollowRequestSQL = `
+		DELETE FROM follow_requests
+		WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteFollowRequestSQL, blockerUser.ID, blockedUser.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	c.log.Info("user blocked", "blocker_id", blockerUser.ID, "blocked_id", blockedUser.ID)
+
+	profile := profileOf(blockedUser)
+	profile.Blocking = true
+	return profile, nil
+}
+
+func (c *Core) UnblockUser(ctx context.Context, blockerUser auth.User, blockedUserName string) (*models.Profile, error) {
+	blockedUser, err := c.GetUserByUsername(ctx, blockedUserName)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const deleteSQL = `
+		DELETE FROM user_blocks
+		WHERE blocker_id = $1 AND blocked_id = $2
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, blockerUser.ID, blockedUser.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, xerrors.New(UserIsNotBlocked)
+	}
+
+	return profileOf(blockedUser), nil
+}
+
+// MuteUser hides the muted user's articles and comments from the muter's article and comment lists.
+func (c *Core) MuteUser(ctx context.Context, muterUser auth.User, mutedUserName string) (*models.Profile, error) {
+	mutedUser, err := c.GetUserByUsername(ctx, mutedUserName)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if mutedUser.ID == muterUser.ID {
+		return nil, xerrors.New(ErrCannotBlockYourself)
+	}
+
+	const insertSQL = `
+		INSERT INTO user_mutes (muter_id, muted_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, muterUser.ID, mutedUser.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	profile := profileOf(mutedUser)
+	profile.Muting = true
+	return profile, nil
+}
+
+func (c *Core) UnmuteUser(ctx context.Context, muterUser auth.User, mutedUserName string) (*models.Profile, error) {
+	mutedUser, err := c.GetUserByUsername(ctx, mutedUserName)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const deleteSQL = `
+		DELETE FROM user_mutes
+		WHERE muter_id = $1 AND muted_id = $2
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, muterUser.ID, mutedUser.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, xerrors.New(UserIsNotMuted)
+	}
+
+	return profileOf(mutedUser), nil
+}
+
+// IsBlockedBy reports whether blockerId has blocked userId.
+func (c *Core) IsBlockedBy(ctx context.Context, userId, blockerId int64) (bool, error) {
+	const selectSQL = `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+		)
+	`
+
+	isBlocked, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanBool, blockerId, userId)
+	if err != nil {
+		return false, xerrors.New(err)
+	}
+
+	return isBlocked, nil
+}
+
+// IsIgnoredBy reports whether userId has muted or blocked the user of the username.
+func (c *Core) IsIgnoredBy(ctx context.Context, username string, userId int64) (bool, error) {
+	const selectSQL = `
+		SELECT EXISTS (SELECT 1 FROM user_mutes AS m JOIN users AS u ON u.id = m.muted_id WHERE m.muter_id = $1 AND u.username = $2)
+		    OR EXISTS (SELECT 1 FROM user_blocks AS b JOIN users AS u ON u.id = b.blocked_id WHERE b.blocker_id = $1 AND u.username = $2)
+	`
+
+	isIgnored, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanBool, userId, username)
+	if err != nil {
+		return false, xerrors.New(err)
+	}
+
+	return isIgnored, nil
+}
+
+// checkNotBlockedByArticleAuthor returns ErrBlockedByUser when the author of the article has blocked the user.
+func (c *Core) checkNotBlockedByArticleAuthor(ctx context.Context, articleId, userId int64) error {
+	const selectSQL = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_blocks AS b
+			    JOIN articles AS a ON a.author_id = b.blocker_id
+			WHERE a.id = $1 AND b.blocked_id = $2
+		)
+	`
+
+	isBlocked, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanBool, articleId, userId)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	if isBlocked {
+		return xerrors.New(ErrBlockedByUser)
+	}
+
+	return nil
+}
+
+func profileOf(user *auth.User) *models.Profile {
+	return &models.Profile{
+		ID:       user.ID,
+		Username: user.Username,
+		Bio:      user.Bio,
+		Image:    user.Image,
+		Private:  user.IsPrivate,
+	}
+}
+
+func scanBool(rows *sql.Rows) (bool, error) {
+	var value bool
+	if err := rows.Scan(&value); err != nil {
+		return false, xerrors.New(err)
+	}
+	return value, nil
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// BookmarkArticle adds the article to the reading list of the user. Bookmarks are private, so unlike a
+// favorite a bookmark emits no event.
+func (c *Core) BookmarkArticle(ctx context.Context, slug string, user *auth.User) (*models.Article, error) {
+	article, err := c.GetArticleBySlugForViewer(ctx, slug, user)
+	if err != nil {
+		return nil, err
+	}
+
+	const insertSQL = `
+		INSERT INTO bookmarks (user_id, article_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, article_id) DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, user.ID, article.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return article, nil
+}
+
+// UnbookmarkArticle removes the article from the reading list of the user, even if the user is no
+// longer allowed to see it. The article is only returned when the user can see it, otherwise the
+// bookmark is removed and NoRecordFound is returned.
+func (c *Core) UnbookmarkArticle(ctx context.Context, slug string, user *auth.User) (*models.Article, error) {
+	article, err := c.GetArticleBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	const deleteSQL = `
+		DELETE FROM bookmarks
+		WHERE user_id = $1 AND article_id = $2
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, user.ID, article.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return c.GetArticleBySlugForViewer(ctx, slug, user)
+}
+
+// BookmarkedArticleByArticleId tells for each article whether the user has bookmarked it.
+func (c *Core) BookmarkedArticleByArticleId(ctx context.Context, articleIdList []int64, user *auth.User) (map[int64]bool, error) {
+	result := map[int64]bool{}
+	for _, articleId := range articleIdList {
+		result[articleId] = false
+	}
+	if user == nil || len(articleIdList) == 0 {
+		return result, nil
+	}
+
+	const selectSQL = `
+		SELECT article_id FROM bookmarks WHERE user_id = $1 AND article_id = ANY($2::bigint[])
+	`
+	bookmarkedIds, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanInt64, user.ID, pq.Array(articleIdList))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	for _, articleId := range bookmarkedIds {
+		result[articleId] = true
+	}
+
+	return result, nil
+}
+
+// GetBookmarkedArticles returns the reading list of the user, the latest bookmark first. Bookmarked
+// articles the user can no longer see are left out but kept in the list.
+func (c *Core) GetBookmarkedArticles(ctx context.Context, filter filter.Filter, user *auth.User) ([]*models.Article, error) {
+	selectSQL := `
+		SELECT ` + articleColumns + `
+		FROM bookmarks AS b
+		    JOIN articles AS a ON a.id = b.article_id
+		    JOIN users AS u ON u.id = a.author_id
+		WHERE b.user_id = $1
+		  AND u.deleted_at IS NULL
+		  AND ` + articleVisibilityClause("$1") + `
+		ORDER BY b.created_at DESC, a.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	articles, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanArticle, user.ID, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return articles, nil
+}
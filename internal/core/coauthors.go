@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+var (
+	ErrCoAuthorIsAuthor        = xerrors.Message("User is the author of the article")
+	ErrAlreadyCoAuthor         = xerrors.Message("User is already a co-author of the article or invited to be one")
+	ErrNotCoAuthor             = xerrors.Message("User is not a co-author of the article")
+	CoAuthorInvitationNotFound = xerrors.Message("Co-author invitation not found")
+)
+
+// InviteCoAuthor invites the user of the username to co-author the article. The invitation has no effect
+// until the user accepts it. Users who have blocked the author can't be invited.
+func (c *Core) InviteCoAuthor(ctx context.Context, article *models.Article, username string) error {
+	invitee, err := c.GetUserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if invitee.ID == article.AuthorID {
+		return xerrors.New(ErrCoAuthorIsAuthor)
+	}
+
+	isBlocked, err := c.IsBlockedBy(ctx, article.AuthorID, invitee.ID)
+	if err != nil {
+		return err
+	}
+	if isBlocked {
+		return xerrors.New(ErrBlockedByUser)
+	}
+
+	const insertSQL = `
+		INSERT INTO article_authors (article_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (article_id, user_id) DO NOTHING
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, article.ID, invitee.ID)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.New(ErrAlreadyCoAuthor)
+	}
+
+	return c.emit(ctx, events.Event{
+		Type:      events.CoAuthorInvited,
+		ActorID:   article.AuthorID,
+		ArticleID: article.ID,
+		UserID:    invitee.ID,
+	})
+}
+
+// RemoveCoAuthor removes the user of the username from the co-authors of the article, or withdraws the
+// invitation if it wasn't accepted yet.
+func (c *Core) RemoveCoAuthor(ctx context.Context, article *models.Article, username string) error {
+	const deleteSQL = `
+		DELETE FROM article_authors AS aa
+		USING users AS u
+		WHERE aa.user_id = u.id AND aa.article_id = $1 AND u.username = $2
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, article.ID, username)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.New(ErrNotCoAuthor)
+	}
+
+	return nil
+}
+
+// GetCoAuthorInvitations returns the articles the user is invited to co-author and hasn't answered yet,
+// oldest invitation first.
+func (c *Core) GetCoAuthorInvitations(ctx context.Context, user *auth.User, filter filter.Filter) ([]*models.Article, error) {
+	const selectSQL = `
+		SELECT ` + articleColumns + `
+		FROM article_authors AS aa
+		    JOIN articles AS a ON a.id = aa.article_id
+		    JOIN users AS u ON u.id = a.author_id
+		WHERE aa.user_id = $1 AND aa.accepted_at IS NULL AND u.deleted_at IS NULL
+		ORDER BY aa.created_at, a.id
+		LIMIT $2 OFFSET $3
+	`
+
+	articles, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanArticle, user.ID, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return articles, nil
+}
+
+// AcceptCoAuthorInvitation makes the user a co-author of the article of the slug.
+func (c *Core) AcceptCoAuthorInvitation(ctx context.Context, slug string, user *auth.User) (*models.Article, error) {
+	article, err := c.GetArticleBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	const updateSQL = `
+		UPDATE article_authors
+		SET accepted_at = NOW()
+		WHERE article_id = $1 AND user_id = $2 AND accepted_at IS NULL
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, article.ID, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, xerrors.New(CoAuthorInvitationNotFound)
+	}
+
+	return article, nil
+}
+
+// DeclineCoAuthorInvitation removes the invitation of the user to co-author the article of the slug.
+func (c *Core) DeclineCoAuthorInvitation(ctx context.Context, slug string, user *auth.User) (*models.Article, error) {
+	article, err := c.GetArticleBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	const deleteSQL = `
+		DELETE FROM article_authors
+		WHERE article_id = $1 AND user_id = $2 AND accepted_at IS NULL
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, article.ID, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, xerrors.New(CoAuthorInvitationNotFound)
+	}
+
+	return article, nil
+}
+
+// CoAuthorIdsByArticleId returns the co-authors who accepted their invitation to each article, in the order
+// they accepted it. Accounts pending deletion are left out.
+func (c *Core) CoAuthorIdsByArticleId(ctx context.Context, articleIdList []int64) (map[int64][]int64, error) {
+	result := map[int64][]int64{}
+	if len(articleIdList) == 0 {
+		return result, nil
+	}
+
+	const selectSQL = `
+		SELECT aa.article_id, aa.user_id
+		FROM article_authors AS aa
+		    JOIN users AS u ON u.id = aa.user_id
+		WHERE aa.article_id = ANY($1::bigint[]) AND aa.accepted_at IS NOT NULL AND u.deleted_at IS NULL
+		ORDER BY aa.article_id, aa.accepted_at, aa.user_id
+	`
+
+	type articleAuthor struct {
+		articleId int64
+		userId    int64
+	}
+
+	authors, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (articleAuthor, error) {
+		var author articleAuthor
+		if err := rows.Scan(&author.articleId, &author.userId); err != nil {
+			return author, xerrors.New(err)
+		}
+		return author, nil
+	}, pq.Array(articleIdList))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	for _, author := range authors {
+		result[author.articleId] = append(result[author.articleId], author.userId)
+	}
+
+	return result, nil
+}
@@ -3,13 +3,24 @@ package core
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/events"
 	"github.com/siahsang/blog/internal/utils/databaseutils"
 	"github.com/siahsang/blog/models"
 )
 
 func (c *Core) CreateComment(context context.Context, comment *models.Comment) (*models.Comment, error) {
+	if err := c.checkArticleVisible(context, comment.ArticleID, comment.AuthorID); err != nil {
+		return nil, err
+	}
+
+	if err := c.checkNotBlockedByArticleAuthor(context, comment.ArticleID, comment.AuthorID); err != nil {
+		return nil, err
+	}
+
 	insertSQL := `
 		INSERT INTO comments (body,created_at,updated_at,author_id,article_id)
 		VALUES ($1, $2, $3, $4, $5)
@@ -28,20 +39,32 @@ func (c *Core) CreateComment(context context.Context, comment *models.Comment) (
 		return nil, xerrors.New(err)
 	}
 
+	if err := c.emit(context, events.Event{
+		Type:      events.CommentCreated,
+		ActorID:   newComment.AuthorID,
+		ArticleID: newComment.ArticleID,
+		CommentID: newComment.ID,
+	}); err != nil {
+		return nil, err
+	}
+
 	return newComment, nil
 }
 
-func (c *Core) GetCommentsBySlug(context context.Context, slug string) ([]*models.Comment, error) {
-	bySlug, err := c.GetArticleBySlug(context, slug)
+// GetCommentsBySlug returns the comments of the article. Comments by users the viewer has muted are left out.
+func (c *Core) GetCommentsBySlug(context context.Context, slug string, viewer *auth.User) ([]*models.Comment, error) {
+	bySlug, err := c.GetArticleBySlugForViewer(context, slug, viewer)
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
 	query := `
-		SELECT id,body,created_at,updated_at,author_id,article_id
-		FROM comments
-		WHERE article_id = $1
-		ORDER BY created_at DESC
+		SELECT c.id,c.body,c.created_at,c.updated_at,c.author_id,c.article_id
+		FROM comments AS c
+		    JOIN users AS u ON c.author_id = u.id
+		WHERE c.article_id = $1 AND u.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes AS m WHERE m.muter_id = $2 AND m.muted_id = c.author_id)
+		ORDER BY c.created_at DESC
 	`
 	comments, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (*models.Comment, error) {
 		var comment models.Comment
@@ -49,7 +72,7 @@ func (c *Core) GetCommentsBySlug(context context.Context, slug string) ([]*model
 			return nil, xerrors.New(err)
 		}
 		return &comment, nil
-	}, bySlug.ID)
+	}, bySlug.ID, viewerId(viewer))
 
 	if err != nil {
 		return nil, xerrors.New(err)
@@ -58,6 +81,31 @@ func (c *Core) GetCommentsBySlug(context context.Context, slug string) ([]*model
 	return comments, nil
 }
 
+func (c *Core) GetCommentById(ctx context.Context, commentId int64) (*models.Comment, error) {
+	const selectSQL = `
+		SELECT id,body,created_at,updated_at,author_id,article_id
+		FROM comments
+		WHERE id = $1
+	`
+
+	comment, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*models.Comment, error) {
+		var comment models.Comment
+		if err := rows.Scan(&comment.ID, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt, &comment.AuthorID, &comment.ArticleID); err != nil {
+			return nil, xerrors.New(err)
+		}
+		return &comment, nil
+	}, commentId)
+
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, NoRecordFound
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return comment, nil
+}
+
 func (c *Core) DeleteCommentById(ctx context.Context, commentId int64) (int64, error) {
 	deleteSQL := `
 		DELETE FROM comments
@@ -2,8 +2,10 @@ package core
 
 import (
 	"database/sql"
-	"github.com/siahsang/blog/internal/utils/databaseutils"
 	"log/slog"
+
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
 )
 
 type Core struct {
@@ -19,3 +21,11 @@ func NewCore(dbConn *sql.DB, log *slog.Logger, sqlTemplate *databaseutils.SQLTem
 		sqlTemplate: sqlTemplate,
 	}
 }
+
+// viewerId returns the id of the viewer, or 0 for anonymous requests so it never matches a user.
+func viewerId(viewer *auth.User) int64 {
+	if viewer == nil {
+		return 0
+	}
+	return viewer.ID
+}
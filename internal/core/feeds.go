@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/utils/collectionutils"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// GetFeedToken returns the token of the user's private feed, creating it on first use.
+func (c *Core) GetFeedToken(ctx context.Context, user *auth.User) (string, error) {
+	const selectSQL = `
+		SELECT COALESCE(feed_token, '') FROM users WHERE id = $1
+	`
+	token, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanString, user.ID)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return "", xerrors.New(NoRecordFound)
+		}
+		return "", xerrors.New(err)
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	return c.ResetFeedToken(ctx, user)
+}
+
+// ResetFeedToken replaces the token of the user's private feed, so the old feed url stops working.
+func (c *Core) ResetFeedToken(ctx context.Context, user *auth.User) (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", xerrors.New(err)
+	}
+
+	const updateSQL = `
+		UPDATE users SET feed_token = $2 WHERE id = $1
+		RETURNING feed_token
+	`
+	token, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, updateSQL, scanString, user.ID, hex.EncodeToString(secret))
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return "", xerrors.New(NoRecordFound)
+		}
+		return "", xerrors.New(err)
+	}
+
+	return token, nil
+}
+
+// GetUserByFeedToken returns the owner of a private feed.
+func (c *Core) GetUserByFeedToken(ctx context.Context, token string) (*auth.User, error) {
+	const selectSQL = `
+		SELECT email FROM users WHERE feed_token = $1 AND deleted_at IS NULL AND NOT anonymized
+	`
+	email, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanString, token)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return c.GetUserByEmail(ctx, email)
+}
+
+// GetFeedReasons tells for each article why it is in the personal feed of the user: its author is
+// followed, or which of its tags are.
+func (c *Core) GetFeedReasons(ctx context.Context, user *auth.User, articleIdList []int64) (map[int64]*models.FeedReason, error) {
+	const selectSQL = `
+		SELECT a.id,
+		       EXISTS(SELECT 1 FROM followers AS f WHERE f.user_id = a.author_id AND f.follower_id = $1),
+		       ARRAY(SELECT t.display_name
+		             FROM articles_tags AS at
+		                 JOIN tag_follows AS tf ON tf.tag_id = at.tag_id AND tf.user_id = $1
+		                 JOIN tags AS t ON t.id = at.tag_id
+		             WHERE at.article_id = a.id
+		             ORDER BY t.name)
+		FROM articles AS a
+		WHERE a.id = ANY($2)
+	`
+
+	type articleReason struct {
+		ArticleID int64
+		Reason    *models.FeedReason
+	}
+	reasons, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (articleReason, error) {
+		result := articleReason{Reason: &models.FeedReason{}}
+		if err := rows.Scan(&result.ArticleID, &result.Reason.FollowedAuthor, pq.Array(&result.Reason.FollowedTags)); err != nil {
+			return articleReason{}, xerrors.New(err)
+		}
+		return result, nil
+	}, user.ID, pq.Array(articleIdList))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return collectionutils.Associate(reasons, func(item articleReason) (int64, *models.FeedReason) {
+		return item.ArticleID, item.Reason
+	}), nil
+}
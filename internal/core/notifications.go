@@ -0,0 +1,230 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/stringutils"
+	"github.com/siahsang/blog/models"
+)
+
+// Notification types
+const (
+	NotificationComment        = "comment"
+	NotificationFavorite       = "favorite"
+	NotificationFollow         = "follow"
+	NotificationFollowRequest  = "follow_request"
+	NotificationCoAuthorInvite = "coauthor_invitation"
+)
+
+// CreateNotificationForEvent turns the event into a notification for the user it concerns. Unread
+// notifications of the same type about the same article are aggregated into a single row that
+// keeps track of every distinct actor. It is expected to run inside a transaction, and returns nil
+// when the event doesn't notify anybody.
+func (c *Core) CreateNotificationForEvent(ctx context.Context, event events.Event) (*models.Notification, error) {
+	var (
+		notificationType string
+		recipientId      int64
+		articleId        *int64
+	)
+
+	switch event.Type {
+	case events.CommentCreated, events.ArticleFavorited:
+		article, err := c.GetArticleById(ctx, event.ArticleID)
+		if err != nil {
+			// the article was deleted before the event was dispatched, there is nothing to notify about
+			if errors.Is(err, NoRecordFound) {
+				return nil, nil
+			}
+			return nil, xerrors.New(err)
+		}
+
+		notificationType = NotificationComment
+		if event.Type == events.ArticleFavorited {
+			notificationType = NotificationFavorite
+		}
+		recipientId = article.AuthorID
+		articleId = &article.ID
+	case events.UserFollowed:
+		notificationType = NotificationFollow
+		recipientId = event.UserID
+	case events.FollowRequested:
+		notificationType = NotificationFollowRequest
+		recipientId = event.UserID
+	case events.CoAuthorInvited:
+		notificationType = NotificationCoAuthorInvite
+		recipientId = event.UserID
+		articleId = &event.ArticleID
+	default:
+		return nil, nil
+	}
+
+	if recipientId == event.ActorID {
+		return nil, nil
+	}
+
+	// nobody gets notified about users they have blocked or muted
+	const ignoredSQL = `
+		SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)
+		    OR EXISTS (SELECT 1 FROM user_mutes WHERE muter_id = $1 AND muted_id = $2)
+	`
+	isIgnored, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, ignoredSQL, scanBool, recipientId, event.ActorID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if isIgnored {
+		return nil, nil
+	}
+
+	const upsertSQL = `
+		INSERT INTO notifications (user_id, type, article_id, last_actor_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, type, (COALESCE(article_id, 0))) WHERE read_at IS NULL
+		DO UPDATE SET last_actor_id = EXCLUDED.last_actor_id, updated_at = NOW()
+		RETURNING id
+	`
+	notificationId, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, upsertSQL, scanInt64,
+		recipientId, notificationType, articleId, event.ActorID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const insertActorSQL = `
+		INSERT INTO notification_actors (notification_id, actor_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertActorSQL, notificationId, event.ActorID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const updateCountSQL = `
+		UPDATE notifications
+		SET actor_count = (SELECT COUNT(*) FROM notification_actors WHERE notification_id = $1)
+		WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateCountSQL, notificationId); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return c.getNotificationById(ctx, notificationId)
+}
+
+// GetNotifications returns the notifications of the user, most recently updated first.
+func (c *Core) GetNotifications(ctx context.Context, user *auth.User, filter filter.Filter, unreadOnly bool) ([]*models.Notification, error) {
+	selectSQL := `
+		SELECT n.id, n.user_id, n.type, n.article_id, a.slug, a.title, u.username, u.image,
+		       n.actor_count, n.created_at, n.updated_at, n.read_at
+		FROM notifications AS n
+		    LEFT JOIN articles AS a ON n.article_id = a.id
+		    LEFT JOIN users AS u ON n.last_actor_id = u.id
+		WHERE n.user_id = $1
+	`
+	if unreadOnly {
+		selectSQL += " AND n.read_at IS NULL"
+	}
+	selectSQL += " ORDER BY n.updated_at DESC LIMIT $2 OFFSET $3"
+
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanNotification, user.ID, filter.Limit, filter.Offset)
+
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+func (c *Core) getNotificationById(ctx context.Context, notificationId int64) (*models.Notification, error) {
+	const selectSQL = `
+		SELECT n.id, n.user_id, n.type, n.article_id, a.slug, a.title, u.username, u.image,
+		       n.actor_count, n.created_at, n.updated_at, n.read_at
+		FROM notifications AS n
+		    LEFT JOIN articles AS a ON n.article_id = a.id
+		    LEFT JOIN users AS u ON n.last_actor_id = u.id
+		WHERE n.id = $1
+	`
+
+	notification, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanNotification, notificationId)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return notification, nil
+}
+
+func (c *Core) CountUnreadNotifications(ctx context.Context, user *auth.User) (int64, error) {
+	const selectSQL = `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	count, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanInt64, user.ID)
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return count, nil
+}
+
+// MarkNotificationsRead marks the given notifications of the user as read and returns how many changed.
+func (c *Core) MarkNotificationsRead(ctx context.Context, user *auth.User, notificationIdList []int64) (int64, error) {
+	if len(notificationIdList) == 0 {
+		return 0, nil
+	}
+
+	placeholders, args := stringutils.INCluse(notificationIdList)
+	updateSQL := fmt.Sprintf(`
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $%d AND read_at IS NULL AND id IN (%s)
+	`, len(args)+1, strings.Join(placeholders, ","))
+	args = append(args, user.ID)
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, args...)
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return rowsAffected, nil
+}
+
+func (c *Core) MarkAllNotificationsRead(ctx context.Context, user *auth.User) (int64, error) {
+	const updateSQL = `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, user.ID)
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return rowsAffected, nil
+}
+
+func scanNotification(rows *sql.Rows) (*models.Notification, error) {
+	notification := &models.Notification{}
+	if err := rows.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.ArticleID,
+		&notification.ArticleSlug, &notification.ArticleTitle, &notification.LastActorUsername, &notification.LastActorImage,
+		&notification.ActorCount, &notification.CreatedAt, &notification.UpdatedAt, &notification.ReadAt); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return notification, nil
+}
+
+func scanInt64(rows *sql.Rows) (int64, error) {
+	var value int64
+	if err := rows.Scan(&value); err != nil {
+		return 0, xerrors.New(err)
+	}
+	return value, nil
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+)
+
+// OutboxEvent is an event claimed by the outbox relay.
+type OutboxEvent struct {
+	ID       int64
+	Attempts int
+	Event    events.Event
+}
+
+// emit writes the event to the outbox. Called with a transaction in ctx, the event is only recorded,
+// and later dispatched by the relay, if the transaction commits.
+func (c *Core) emit(ctx context.Context, event events.Event) error {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	const insertSQL = `
+		INSERT INTO outbox (event_type, payload) VALUES ($1, $2)
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, string(event.Type), string(payload)); err != nil {
+		return xerrors.New(err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents picks up to limit undispatched events, oldest first, and counts the attempt. Their
+// next attempt is pushed back by lease so concurrent relays skip them, and a relay that dies while
+// dispatching only delays them. Events that failed maxAttempts times are left for inspection.
+func (c *Core) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration, maxAttempts int) ([]*OutboxEvent, error) {
+	const claimSQL = `
+		WITH due AS (
+		    SELECT id
+		    FROM outbox
+		    WHERE dispatched_at IS NULL AND available_at <= NOW() AND attempts < $3
+		    ORDER BY id
+		    LIMIT $1
+		    FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox AS o
+		SET attempts     = o.attempts + 1,
+		    available_at = NOW() + make_interval(secs => $2)
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.attempts, o.idempotency_key, o.payload
+	`
+
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, claimSQL, func(rows *sql.Rows) (*OutboxEvent, error) {
+		var (
+			outboxEvent    = &OutboxEvent{}
+			idempotencyKey string
+			payload        []byte
+		)
+		if err := rows.Scan(&outboxEvent.ID, &outboxEvent.Attempts, &idempotencyKey, &payload); err != nil {
+			return nil, xerrors.New(err)
+		}
+		if err := json.Unmarshal(payload, &outboxEvent.Event); err != nil {
+			return nil, xerrors.New(err)
+		}
+		outboxEvent.Event.ID = idempotencyKey
+		return outboxEvent, nil
+	}, limit, lease.Seconds(), maxAttempts)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	// the update doesn't keep the order of the claim
+	slices.SortFunc(result, func(a, b *OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+
+	return result, nil
+}
+
+func (c *Core) MarkOutboxEventDispatched(ctx context.Context, outboxEventId int64) error {
+	const updateSQL = `
+		UPDATE outbox SET dispatched_at = NOW(), last_error = NULL WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, outboxEventId); err != nil {
+		return xerrors.New(err)
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records why dispatching failed and when to try again.
+func (c *Core) MarkOutboxEventFailed(ctx context.Context, outboxEventId int64, dispatchErr error, retryAt time.Time) error {
+	const updateSQL = `
+		UPDATE outbox SET last_error = $2, available_at = $3 WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, outboxEventId, dispatchErr.Error(), retryAt); err != nil {
+		return xerrors.New(err)
+	}
+	return nil
+}
+
+// MarkEventProcessed records that the consumer processed the event and reports whether this is the
+// first time. Called in the transaction of the consumer's work, it makes that work happen once per event.
+func (c *Core) MarkEventProcessed(ctx context.Context, consumer string, event events.Event) (bool, error) {
+	const insertSQL = `
+		INSERT INTO processed_events (consumer, idempotency_key)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, consumer, event.ID)
+	if err != nil {
+		return false, xerrors.New(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// PruneOutbox deletes the dispatched events and the processed event keys older than retention, and
+// returns how many outbox rows were deleted.
+func (c *Core) PruneOutbox(ctx context.Context, retention time.Duration) (int64, error) {
+	const deleteOutboxSQL = `
+		DELETE FROM outbox WHERE dispatched_at < NOW() - make_interval(secs => $1)
+	`
+	deleted, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteOutboxSQL, retention.Seconds())
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	const deleteProcessedSQL = `
+		DELETE FROM processed_events WHERE processed_at < NOW() - make_interval(secs => $1)
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteProcessedSQL, retention.Seconds()); err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return deleted, nil
+}
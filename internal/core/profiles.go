@@ -3,64 +3,74 @@ package core
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+
 	"github.com/mdobak/go-xerrors"
 	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/events"
+	"github.com/siahsang/blog/internal/filter"
 	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/functional"
+	"github.com/siahsang/blog/internal/utils/stringutils"
 	"github.com/siahsang/blog/models"
-	"strings"
 )
 
 var (
-	UserIsAlreadyFollowed = xerrors.Message("User is already followed")
-	UserIsNotFollowed     = xerrors.Message("User is not followed")
+	UserIsAlreadyFollowed    = xerrors.Message("User is already followed")
+	UserIsNotFollowed        = xerrors.Message("User is not followed")
+	FollowIsAlreadyRequested = xerrors.Message("Follow request is already sent")
+	FollowRequestNotFound    = xerrors.Message("Follow request not found")
 )
 
-// todo: use one sql query to fetch user and following status
-func (c *Core) GetProfileByUserName(ctx context.Context, username string) (*models.Profile, error) {
+// GetProfileByUserName returns the profile with the relation flags (following, blocking, ...) computed for the viewer.
+func (c *Core) GetProfileByUserName(ctx context.Context, username string, viewer *auth.User) (*models.Profile, error) {
+	// todo: use one sql query to fetch user and following status
 
-	const queryFollowing = `
-		SELECT EXISTS (
-			SELECT 1 FROM followers WHERE follower_id = $1
-		)
+	const queryRelation = `
+		SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+		       EXISTS (SELECT 1 FROM follow_requests WHERE user_id = $1 AND requester_id = $2),
+		       EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $2 AND blocked_id = $1),
+		       EXISTS (SELECT 1 FROM user_mutes WHERE muter_id = $2 AND muted_id = $1)
 	`
 
 	// Fetch user info
-	profile := &models.Profile{}
 	user, err := c.GetUserByUsername(ctx, username)
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
-	profile.ID = user.ID
-	profile.Username = user.Username
-	profile.Bio = user.Bio
-	profile.Image = user.Image
+	profile := profileOf(user)
 
-	// Check following status
-	isFollowing, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, queryFollowing, func(rows *sql.Rows) (bool, error) {
-		var isFollowing bool
-		if err := rows.Scan(&isFollowing); err != nil {
-			return false, xerrors.New(err)
+	// Check the viewer's relation to the profile
+	_, err = databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, queryRelation, func(rows *sql.Rows) (*models.Profile, error) {
+		if err := rows.Scan(&profile.Following, &profile.FollowRequested, &profile.Blocking, &profile.Muting); err != nil {
+			return nil, xerrors.New(err)
 		}
-		return isFollowing, nil
-	}, profile.ID)
+		return profile, nil
+	}, profile.ID, viewerId(viewer))
 
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
-	profile.Following = isFollowing
+	followCountsByUserId, err := c.FollowCountsByUserId(ctx, []int64{profile.ID})
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	profile.FollowersCount = followCountsByUserId[profile.ID].Followers
+	profile.FollowingCount = followCountsByUserId[profile.ID].Following
 
 	return profile, nil
 }
 
-func (c *Core) GetProfileByUserId(ctx context.Context, userId int64) (*models.Profile, error) {
+func (c *Core) GetProfileByUserId(ctx context.Context, userId int64, viewer *auth.User) (*models.Profile, error) {
 	user, err := c.GetUsersById(ctx, userId)
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
-	return c.GetProfileByUserName(ctx, user.Username)
+	return c.GetProfileByUserName(ctx, user.Username, viewer)
 }
 
 func (c *Core) GetFollowingUserList(ctx context.Context, username string) ([]*auth.User, error) {
@@ -102,6 +112,20 @@ func (c *Core) FollowUser(ctx context.Context, followerUser auth.User, followeeU
 		return nil, xerrors.New(err)
 	}
 
+	isBlocked, err := c.IsBlockedBy(ctx, followerUser.ID, followeeUser.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if isBlocked {
+		return nil, xerrors.New(ErrBlockedByUser)
+	}
+
+	// following a private profile only creates a request the owner has to approve
+	if followeeUser.IsPrivate {
+		return c.requestToFollow(ctx, followerUser, followeeUser)
+	}
+
 	insertSql := `
 		INSERT INTO followers (user_id, follower_id)
 		VALUES ($1, $2)
@@ -116,7 +140,7 @@ func (c *Core) FollowUser(ctx context.Context, followerUser auth.User, followeeU
 			return false, xerrors.New(err)
 		}
 		return true, nil
-	}, args)
+	}, args...)
 
 	if err != nil {
 		switch {
@@ -127,7 +151,15 @@ func (c *Core) FollowUser(ctx context.Context, followerUser auth.User, followeeU
 		}
 	}
 
-	profile, err := c.GetProfileByUserName(ctx, followerUser.Username)
+	if err := c.emit(ctx, events.Event{
+		Type:    events.UserFollowed,
+		ActorID: followerUser.ID,
+		UserID:  followeeUser.ID,
+	}); err != nil {
+		return nil, err
+	}
+
+	profile, err := c.GetProfileByUserName(ctx, followeeUser.Username, &followerUser)
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
@@ -152,14 +184,317 @@ func (c *Core) UnfollowUser(ctx context.Context, followerUser auth.User, followe
 		return nil, xerrors.New(err)
 	}
 
+	if rowsAffected == 0 {
+		// unfollowing a private profile that hasn't approved yet withdraws the request
+		const deleteRequestSql = `
+			DELETE FROM follow_requests
+			WHERE user_id = $1 AND requester_id = $2
+		`
+		rowsAffected, err = databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteRequestSql, followeeUser.ID, followerUser.ID)
+		if err != nil {
+			return nil, xerrors.New(err)
+		}
+	}
+
 	if rowsAffected == 0 {
 		return nil, xerrors.New(UserIsNotFollowed)
 	}
 
-	profile, err := c.GetProfileByUserName(ctx, followerUser.Username)
+	profile, err := c.GetProfileByUserName(ctx, followeeUser.Username, &followerUser)
 	if err != nil {
 		return nil, xerrors.New(err)
 	}
 
 	return profile, nil
 }
+
+type FollowCounts struct {
+	Followers int64
+	Following int64
+}
+
+// GetFollowers returns the users following the given user, ordered by username.
+func (c *Core) GetFollowers(ctx context.Context, username string, filter filter.Filter) ([]*auth.User, error) {
+	const selectSQL = `
+		SELECT u.id, u.email, u.username, u.password, u.bio, u.image, u.is_private
+		FROM followers AS f
+		    JOIN users AS u ON f.follower_id = u.id
+		WHERE f.user_id = $1 AND u.deleted_at IS NULL
+		ORDER BY u.username
+		LIMIT $2 OFFSET $3
+	`
+
+	return c.getFollowRelationList(ctx, selectSQL, username, filter)
+}
+
+// GetFollowing returns the users the given user follows, ordered by username.
+func (c *Core) GetFollowing(ctx context.Context, username string, filter filter.Filter) ([]*auth.User, error) {
+	const selectSQL = `
+		SELECT u.id, u.email, u.username, u.password, u.bio, u.image, u.is_private
+		FROM followers AS f
+		    JOIN users AS u ON f.user_id = u.id
+		WHERE f.follower_id = $1 AND u.deleted_at IS NULL
+		ORDER BY u.username
+		LIMIT $2 OFFSET $3
+	`
+
+	return c.getFollowRelationList(ctx, selectSQL, username, filter)
+}
+
+func (c *Core) getFollowRelationList(ctx context.Context, selectSQL string, username string, filter filter.Filter) ([]*auth.User, error) {
+	user, err := c.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	queryResultList, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*auth.User, error) {
+		var tempUser = &auth.User{}
+
+		if err := rows.Scan(&tempUser.ID,
+			&tempUser.Email,
+			&tempUser.Username,
+			&tempUser.Password,
+			&tempUser.Bio,
+			&tempUser.Image,
+			&tempUser.IsPrivate); err != nil {
+			return nil, xerrors.New(err)
+		}
+		return tempUser, nil
+	}, user.ID, filter.Limit, filter.Offset)
+
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return queryResultList, nil
+}
+
+// GetProfilesForViewer builds the profiles of the users, with the following flag computed for the viewer.
+func (c *Core) GetProfilesForViewer(ctx context.Context, users []*auth.User, viewer *auth.User) ([]*models.Profile, error) {
+	userIdList := functional.Map(users, func(user *auth.User) int64 {
+		return user.ID
+	})
+
+	followingByUserId, err := c.FollowingByUserId(ctx, userIdList, viewer)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	followCountsByUserId, err := c.FollowCountsByUserId(ctx, userIdList)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return functional.Map(users, func(user *auth.User) *models.Profile {
+		profile := profileOf(user)
+		profile.Following = followingByUserId[user.ID]
+		profile.FollowersCount = followCountsByUserId[user.ID].Followers
+		profile.FollowingCount = followCountsByUserId[user.ID].Following
+		return profile
+	}), nil
+}
+
+// FollowingByUserId reports, for every user in the list, whether the viewer follows them.
+func (c *Core) FollowingByUserId(ctx context.Context, userIdList []int64, viewer *auth.User) (map[int64]bool, error) {
+	result := map[int64]bool{}
+	for _, userId := range userIdList {
+		result[userId] = false
+	}
+	if viewer == nil || len(userIdList) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := stringutils.INCluse(userIdList)
+	selectSQL := fmt.Sprintf(`
+		SELECT user_id FROM followers WHERE follower_id = $%d AND user_id IN (%s)
+	`, len(args)+1, strings.Join(placeholders, ","))
+	args = append(args, viewer.ID)
+
+	queryResult, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (int64, error) {
+		var userId int64
+		if err := rows.Scan(&userId); err != nil {
+			return 0, xerrors.New(err)
+		}
+		return userId, nil
+	}, args...)
+
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	for _, userId := range queryResult {
+		result[userId] = true
+	}
+
+	return result, nil
+}
+
+func (c *Core) FollowCountsByUserId(ctx context.Context, userIdList []int64) (map[int64]FollowCounts, error) {
+	result := map[int64]FollowCounts{}
+	if len(userIdList) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := stringutils.INCluse(userIdList)
+	selectSQL := fmt.Sprintf(`
+		SELECT u.id,
+		       (SELECT COUNT(*) FROM followers AS f WHERE f.user_id = u.id),
+		       (SELECT COUNT(*) FROM followers AS f WHERE f.follower_id = u.id)
+		FROM users AS u
+		WHERE u.id IN (%s)
+	`, strings.Join(placeholders, ","))
+
+	type QueryResult struct {
+		UserId int64
+		Counts FollowCounts
+	}
+
+	queryResultList, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (QueryResult, error) {
+		var qr QueryResult
+		if err := rows.Scan(&qr.UserId, &qr.Counts.Followers, &qr.Counts.Following); err != nil {
+			return qr, xerrors.New(err)
+		}
+		return qr, nil
+	}, args...)
+
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	for _, qr := range queryResultList {
+		result[qr.UserId] = qr.Counts
+	}
+
+	return result, nil
+}
+
+func (c *Core) requestToFollow(ctx context.Context, followerUser auth.User, followeeUser *auth.User) (*models.Profile, error) {
+	isFollowing, err := c.FollowingByUserId(ctx, []int64{followeeUser.ID}, &followerUser)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if isFollowing[followeeUser.ID] {
+		return nil, xerrors.New(UserIsAlreadyFollowed)
+	}
+
+	const insertSQL = `
+		INSERT INTO follow_requests (user_id, requester_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, followeeUser.ID, followerUser.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, xerrors.New(FollowIsAlreadyRequested)
+	}
+
+	if err := c.emit(ctx, events.Event{
+		Type:    events.FollowRequested,
+		ActorID: followerUser.ID,
+		UserID:  followeeUser.ID,
+	}); err != nil {
+		return nil, err
+	}
+
+	return c.GetProfileByUserName(ctx, followeeUser.Username, &followerUser)
+}
+
+// GetFollowRequests returns the users waiting for the user to approve their follow request, oldest first.
+func (c *Core) GetFollowRequests(ctx context.Context, user *auth.User, filter filter.Filter) ([]*auth.User, error) {
+	const selectSQL = `
+		SELECT u.id, u.email, u.username, u.password, u.bio, u.image, u.is_private
+		FROM follow_requests AS fr
+		    JOIN users AS u ON fr.requester_id = u.id
+		WHERE fr.user_id = $1 AND u.deleted_at IS NULL
+		ORDER BY fr.created_at
+		LIMIT $2 OFFSET $3
+	`
+
+	return c.getFollowRelationList(ctx, selectSQL, user.Username, filter)
+}
+
+// ApproveFollowRequest turns the pending request of the requester into a follow relation.
+// It is expected to run inside a transaction.
+func (c *Core) ApproveFollowRequest(ctx context.Context, user *auth.User, requesterUserName string) (*models.Profile, error) {
+	requester, err := c.deleteFollowRequest(ctx, user, requesterUserName)
+	if err != nil {
+		return nil, err
+	}
+
+	const insertSQL = `
+		INSERT INTO followers (user_id, follower_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, user.ID, requester.ID); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if err := c.emit(ctx, events.Event{
+		Type:    events.UserFollowed,
+		ActorID: requester.ID,
+		UserID:  user.ID,
+	}); err != nil {
+		return nil, err
+	}
+
+	return c.GetProfileByUserName(ctx, requester.Username, user)
+}
+
+func (c *Core) DenyFollowRequest(ctx context.Context, user *auth.User, requesterUserName string) (*models.Profile, error) {
+	requester, err := c.deleteFollowRequest(ctx, user, requesterUserName)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetProfileByUserName(ctx, requester.Username, user)
+}
+
+func (c *Core) deleteFollowRequest(ctx context.Context, user *auth.User, requesterUserName string) (*auth.User, error) {
+	requester, err := c.GetUserByUsername(ctx, requesterUserName)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const deleteSQL = `
+		DELETE FROM follow_requests
+		WHERE user_id = $1 AND requester_id = $2
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, user.ID, requester.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, xerrors.New(FollowRequestNotFound)
+	}
+
+	return requester, nil
+}
+
+func (c *Core) approveAllFollowRequests(ctx context.Context, userId int64) error {
+	const insertSQL = `
+		INSERT INTO followers (user_id, follower_id)
+		SELECT user_id, requester_id FROM follow_requests WHERE user_id = $1
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, userId); err != nil {
+		return xerrors.New(err)
+	}
+
+	const deleteSQL = `
+		DELETE FROM follow_requests WHERE user_id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, userId); err != nil {
+		return xerrors.New(err)
+	}
+
+	return nil
+}
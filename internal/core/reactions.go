@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// ReactToArticle adds a reaction of the user to the article. Reacting twice with the same reaction is a
+// no-op, different reactions add up.
+func (c *Core) ReactToArticle(ctx context.Context, slug string, user *auth.User, reaction string) (*models.Article, error) {
+	article, err := c.GetArticleBySlugForViewer(ctx, slug, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkNotBlockedByArticleAuthor(ctx, article.ID, user.ID); err != nil {
+		return nil, err
+	}
+
+	const insertSQL = `
+		INSERT INTO article_reactions (user_id, article_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, article_id, reaction) DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, user.ID, article.ID, reaction); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return article, nil
+}
+
+// UnreactToArticle removes a reaction of the user from the article. Like a bookmark, the reaction is removed
+// even if the user can no longer see the article, but the article is then not returned.
+func (c *Core) UnreactToArticle(ctx context.Context, slug string, user *auth.User, reaction string) (*models.Article, error) {
+	article, err := c.GetArticleBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	const deleteSQL = `
+		DELETE FROM article_reactions
+		WHERE user_id = $1 AND article_id = $2 AND reaction = $3
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, user.ID, article.ID, reaction); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return c.GetArticleBySlugForViewer(ctx, slug, user)
+}
+
+// ReactToComment adds a reaction of the user to a comment of the article. Neither the author of the
+// article nor the author of the comment may have blocked the user.
+func (c *Core) ReactToComment(ctx context.Context, slug string, commentId int64, user *auth.User, reaction string) (*models.Comment, error) {
+	comment, err := c.getCommentOfArticle(ctx, slug, commentId, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkNotBlockedByArticleAuthor(ctx, comment.ArticleID, user.ID); err != nil {
+		return nil, err
+	}
+	isBlocked, err := c.IsBlockedBy(ctx, user.ID, comment.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	if isBlocked {
+		return nil, xerrors.New(ErrBlockedByUser)
+	}
+
+	const insertSQL = `
+		INSERT INTO comment_reactions (user_id, comment_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, comment_id, reaction) DO NOTHING
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, user.ID, comment.ID, reaction); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return comment, nil
+}
+
+// UnreactToComment removes a reaction of the user from a comment of the article.
+func (c *Core) UnreactToComment(ctx context.Context, slug string, commentId int64, user *auth.User, reaction string) (*models.Comment, error) {
+	comment, err := c.getCommentOfArticle(ctx, slug, commentId, user)
+	if err != nil {
+		return nil, err
+	}
+
+	const deleteSQL = `
+		DELETE FROM comment_reactions
+		WHERE user_id = $1 AND comment_id = $2 AND reaction = $3
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, user.ID, comment.ID, reaction); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return comment, nil
+}
+
+// ArticleReactionsByArticleId returns the reactions to each article, the first used first.
+func (c *Core) ArticleReactionsByArticleId(ctx context.Context, articleIdList []int64, viewer *auth.User) (map[int64][]models.ReactionCount, error) {
+	return c.reactionsByTargetId(ctx, "article_reactions", "article_id", articleIdList, viewer)
+}
+
+// CommentReactionsByCommentId returns the reactions to each comment, the first used first.
+func (c *Core) CommentReactionsByCommentId(ctx context.Context, commentIdList []int64, viewer *auth.User) (map[int64][]models.ReactionCount, error) {
+	return c.reactionsByTargetId(ctx, "comment_reactions", "comment_id", commentIdList, viewer)
+}
+
+func (c *Core) reactionsByTargetId(ctx context.Context, table string, column string, idList []int64,
+	viewer *auth.User) (map[int64][]models.ReactionCount, error) {
+	result := map[int64][]models.ReactionCount{}
+	if len(idList) == 0 {
+		return result, nil
+	}
+
+	selectSQL := fmt.Sprintf(`
+		SELECT r.%[2]s, r.reaction, COUNT(*), BOOL_OR(r.user_id = $2)
+		FROM %[1]s AS r
+		WHERE r.%[2]s = ANY($1::bigint[])
+		GROUP BY r.%[2]s, r.reaction
+		ORDER BY r.%[2]s, MIN(r.created_at), r.reaction
+	`, table, column)
+
+	type targetReaction struct {
+		targetId int64
+		count    models.ReactionCount
+	}
+
+	reactions, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (targetReaction, error) {
+		var reaction targetReaction
+		if err := rows.Scan(&reaction.targetId, &reaction.count.Reaction, &reaction.count.Count, &reaction.count.Reacted); err != nil {
+			return reaction, xerrors.New(err)
+		}
+		return reaction, nil
+	}, pq.Array(idList), viewerId(viewer))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	for _, reaction := range reactions {
+		result[reaction.targetId] = append(result[reaction.targetId], reaction.count)
+	}
+
+	return result, nil
+}
+
+// getCommentOfArticle returns the comment if it belongs to the article of the slug and the user can see
+// the article.
+func (c *Core) getCommentOfArticle(ctx context.Context, slug string, commentId int64, user *auth.User) (*models.Comment, error) {
+	article, err := c.GetArticleBySlugForViewer(ctx, slug, user)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := c.GetCommentById(ctx, commentId)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ArticleID != article.ID {
+		return nil, xerrors.New(NoRecordFound)
+	}
+
+	return comment, nil
+}
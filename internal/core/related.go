@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// Weights of what makes an article related to another. The text similarity is a rank between 0 and 1.
+const (
+	relatedTagWeight    = 2.0
+	relatedAuthorWeight = 1.0
+	relatedTextWeight   = 3.0
+)
+
+// GetRelatedArticleIds ranks the other articles by the tags they share with the article, whether they
+// have the same author and how well their text matches the title and description of the article. The
+// ranking doesn't depend on the viewer, so it can be cached; GetArticlesByIdsForViewer filters it.
+// Articles have no draft state yet, so every other article is a candidate.
+func (c *Core) GetRelatedArticleIds(ctx context.Context, articleId int64, limit int) ([]int64, error) {
+	// the terms of the title and description are OR-ed, as any of them makes an article similar
+	selectSQL := fmt.Sprintf(`
+		WITH source AS (
+			SELECT a.id, a.author_id,
+			       replace(plainto_tsquery('english', a.title || ' ' || a.description)::text, '&', '|')::tsquery AS terms
+			FROM articles AS a
+			WHERE a.id = $1
+		), candidates AS (
+			SELECT at.article_id AS id
+			FROM articles_tags AS at
+			WHERE at.tag_id IN (SELECT tag_id FROM articles_tags WHERE article_id = $1)
+			UNION
+			SELECT a.id FROM articles AS a JOIN source AS s ON a.author_id = s.author_id
+			UNION
+			SELECT a.id FROM articles AS a JOIN source AS s ON a.search_vector @@ s.terms
+		)
+		SELECT a.id
+		FROM candidates AS cd
+		    JOIN articles AS a ON a.id = cd.id
+		    JOIN users AS u ON u.id = a.author_id
+		    CROSS JOIN source AS s
+		WHERE a.id <> s.id AND u.deleted_at IS NULL
+		ORDER BY (SELECT COUNT(*)
+		          FROM articles_tags AS at
+		          WHERE at.article_id = a.id
+		            AND at.tag_id IN (SELECT tag_id FROM articles_tags WHERE article_id = $1)) * %[1]f
+		       + CASE WHEN a.author_id = s.author_id THEN %[2]f ELSE 0 END
+		       + ts_rank(a.search_vector, s.terms, 32) * %[3]f DESC,
+		         a.created_at DESC
+		LIMIT $2
+	`, relatedTagWeight, relatedAuthorWeight, relatedTextWeight)
+
+	ids, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (int64, error) {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, xerrors.New(err)
+		}
+		return id, nil
+	}, articleId, limit)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return ids, nil
+}
+
+// GetArticlesByIdsForViewer returns the articles of the ids the viewer can see, in the order of the ids.
+// Articles of muted authors are left out.
+func (c *Core) GetArticlesByIdsForViewer(ctx context.Context, ids []int64, viewer *auth.User) ([]*models.Article, error) {
+	if len(ids) == 0 {
+		return []*models.Article{}, nil
+	}
+
+	selectSQL := `
+		SELECT ` + articleColumns + `
+		FROM articles AS a
+		    JOIN users AS u ON u.id = a.author_id
+		WHERE a.id = ANY($1::bigint[])
+		  AND u.deleted_at IS NULL
+		  AND ` + articleVisibilityClause("$2") + `
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes AS m WHERE m.muter_id = $2 AND m.muted_id = a.author_id)
+		ORDER BY array_position($1::bigint[], a.id::bigint)
+	`
+
+	articles, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanArticle, pq.Array(ids), viewerId(viewer))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return articles, nil
+}
@@ -0,0 +1,367 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+var (
+	ErrDuplicatedSeriesSlug   = xerrors.Message("Duplicate series slug")
+	ErrArticleInOtherSeries   = xerrors.Message("article is already part of another series")
+	ErrArticleNotInSeries     = xerrors.Message("article is not part of the series")
+	ErrArticleOfOtherAuthor   = xerrors.Message("only articles of the author of the series can be added to it")
+	ErrSeriesPositionTooLarge = xerrors.Message("position is after the end of the series")
+	ErrInvalidSeriesOrder     = xerrors.Message("the new order must list every article of the series exactly once")
+)
+
+// seriesColumns are the columns scanSeries reads, with the series table aliased as "s".
+const seriesColumns = `s.id, s.slug, s.title, s.description, s.author_id,
+		(SELECT COUNT(*) FROM series_articles AS sa WHERE sa.series_id = s.id), s.created_at, s.updated_at`
+
+func scanSeries(rows *sql.Rows) (*models.Series, error) {
+	series := &models.Series{}
+	if err := rows.Scan(&series.ID, &series.Slug, &series.Title, &series.Description, &series.AuthorID,
+		&series.ArticlesCount, &series.CreatedAt, &series.UpdatedAt); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return series, nil
+}
+
+func (c *Core) CreateSeries(ctx context.Context, series *models.Series) (*models.Series, error) {
+	insertSQL := `
+		INSERT INTO series AS s (slug, title, description, author_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + seriesColumns
+
+	created, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, insertSQL, scanSeries,
+		series.Slug, series.Title, series.Description, series.AuthorID)
+	if err != nil {
+		if strings.Contains(err.Error(), `duplicate key value violates unique constraint`) {
+			return nil, xerrors.New(ErrDuplicatedSeriesSlug)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return created, nil
+}
+
+// GetSeriesBySlug returns the series if the viewer is allowed to see the articles of its author.
+func (c *Core) GetSeriesBySlug(ctx context.Context, slug string, viewer *auth.User) (*models.Series, error) {
+	selectSQL := `
+		SELECT ` + seriesColumns + `
+		FROM series AS s
+		    JOIN users AS u ON u.id = s.author_id
+		WHERE s.slug = $1 AND u.deleted_at IS NULL AND ` + authorVisibilityClause("s.author_id", "$2")
+
+	series, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanSeries, slug, viewerId(viewer))
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return series, nil
+}
+
+// GetSeriesList returns the series the viewer can see, the latest first, optionally of a single author.
+func (c *Core) GetSeriesList(ctx context.Context, filter filter.Filter, authorUsername string, viewer *auth.User) ([]*models.Series, error) {
+	selectSQL := `
+		SELECT ` + seriesColumns + `
+		FROM series AS s
+		    JOIN users AS u ON u.id = s.author_id
+		WHERE u.deleted_at IS NULL
+		  AND ($1 = '' OR u.username = $1)
+		  AND ` + authorVisibilityClause("s.author_id", "$2") + `
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes AS m WHERE m.muter_id = $2 AND m.muted_id = s.author_id)
+		ORDER BY s.created_at DESC, s.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	seriesList, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanSeries,
+		authorUsername, viewerId(viewer), filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return seriesList, nil
+}
+
+func (c *Core) UpdateSeries(ctx context.Context, series *models.Series) (*models.Series, error) {
+	updateSQL := `
+		UPDATE series AS s
+		SET title = $2, description = $3, updated_at = $4
+		WHERE s.id = $1
+		RETURNING ` + seriesColumns
+
+	updated, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, updateSQL, scanSeries,
+		series.ID, series.Title, series.Description, time.Now())
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return updated, nil
+}
+
+// DeleteSeries deletes the series. Its articles are kept.
+func (c *Core) DeleteSeries(ctx context.Context, series *models.Series) error {
+	const deleteSQL = `
+		DELETE FROM series WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, series.ID); err != nil {
+		return xerrors.New(err)
+	}
+
+	return nil
+}
+
+// GetSeriesArticles returns the articles of the series in their order.
+func (c *Core) GetSeriesArticles(ctx context.Context, series *models.Series, viewer *auth.User) ([]*models.Article, error) {
+	selectSQL := `
+		SELECT ` + articleColumns + `
+		FROM series_articles AS sa
+		    JOIN articles AS a ON a.id = sa.article_id
+		    JOIN users AS u ON u.id = a.author_id
+		WHERE sa.series_id = $1 AND u.deleted_at IS NULL AND ` + articleVisibilityClause("$2") + `
+		ORDER BY sa.position
+	`
+
+	articles, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanArticle, series.ID, viewerId(viewer))
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return articles, nil
+}
+
+// AddArticleToSeries puts the article into the series at position, moving the later parts back, or at
+// its end when position is 0.
+func (c *Core) AddArticleToSeries(ctx context.Context, series *models.Series, article *models.Article, position int) error {
+	if article.AuthorID != series.AuthorID {
+		return xerrors.New(ErrArticleOfOtherAuthor)
+	}
+
+	total, err := c.lockSeries(ctx, series.ID)
+	if err != nil {
+		return err
+	}
+
+	currentSeriesId, err := c.getArticleSeriesId(ctx, article.ID)
+	if err != nil && !errors.Is(err, ErrArticleNotInSeries) {
+		return err
+	}
+	if err == nil {
+		if currentSeriesId == series.ID {
+			return nil
+		}
+		return xerrors.New(ErrArticleInOtherSeries)
+	}
+
+	if position == 0 {
+		position = total + 1
+	}
+	if position > total+1 {
+		return xerrors.New(ErrSeriesPositionTooLarge)
+	}
+
+	statements := []struct {
+		sql  string
+		args []any
+	}{
+		{`UPDATE series_articles SET position = position + 1 WHERE series_id = $1 AND position >= $2`, []any{series.ID, position}},
+		{`INSERT INTO series_articles (series_id, article_id, position) VALUES ($1, $2, $3)`, []any{series.ID, article.ID, position}},
+		{`UPDATE series SET updated_at = NOW() WHERE id = $1`, []any{series.ID}},
+	}
+	for _, statement := range statements {
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, statement.sql, statement.args...); err != nil {
+			return xerrors.New(err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveArticleFromSeries takes the article out of the series and moves the later parts forward.
+func (c *Core) RemoveArticleFromSeries(ctx context.Context, series *models.Series, article *models.Article) error {
+	seriesId, err := c.getArticleSeriesId(ctx, article.ID)
+	if err != nil {
+		return err
+	}
+	if seriesId != series.ID {
+		return xerrors.New(ErrArticleNotInSeries)
+	}
+
+	return c.removeArticleFromSeries(ctx, article.ID)
+}
+
+// ReorderSeries puts the articles of the series in the order of articleIds, which must list each of them
+// once.
+func (c *Core) ReorderSeries(ctx context.Context, series *models.Series, articleIds []int64) error {
+	if _, err := c.lockSeries(ctx, series.ID); err != nil {
+		return err
+	}
+
+	const selectSQL = `
+		SELECT article_id FROM series_articles WHERE series_id = $1
+	`
+	currentIds, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanInt64, series.ID)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	sortedIds := slices.Clone(articleIds)
+	slices.Sort(sortedIds)
+	slices.Sort(currentIds)
+	if !slices.Equal(sortedIds, currentIds) {
+		return xerrors.New(ErrInvalidSeriesOrder)
+	}
+
+	statements := []struct {
+		sql  string
+		args []any
+	}{
+		{`
+			UPDATE series_articles AS sa
+			SET position = o.position
+			FROM unnest($2::bigint[]) WITH ORDINALITY AS o(article_id, position)
+			WHERE sa.series_id = $1 AND sa.article_id = o.article_id
+		`, []any{series.ID, pq.Array(articleIds)}},
+		{`UPDATE series SET updated_at = NOW() WHERE id = $1`, []any{series.ID}},
+	}
+	for _, statement := range statements {
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, statement.sql, statement.args...); err != nil {
+			return xerrors.New(err)
+		}
+	}
+
+	return nil
+}
+
+// GetSeriesPart places the article in its series, or returns nil when it is not part of one. The other
+// parts are by the same author, so whoever can see the article can see them.
+func (c *Core) GetSeriesPart(ctx context.Context, articleId int64) (*models.SeriesPart, error) {
+	const selectSQL = `
+		SELECT s.slug, s.title, sa.position,
+		       (SELECT COUNT(*) FROM series_articles AS t WHERE t.series_id = s.id),
+		       prev.slug, prev.title, next.slug, next.title
+		FROM series_articles AS sa
+		    JOIN series AS s ON s.id = sa.series_id
+		    LEFT JOIN series_articles AS psa ON psa.series_id = sa.series_id AND psa.position = sa.position - 1
+		    LEFT JOIN articles AS prev ON prev.id = psa.article_id
+		    LEFT JOIN series_articles AS nsa ON nsa.series_id = sa.series_id AND nsa.position = sa.position + 1
+		    LEFT JOIN articles AS next ON next.id = nsa.article_id
+		WHERE sa.article_id = $1
+	`
+
+	part, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*models.SeriesPart, error) {
+		var (
+			part                = &models.SeriesPart{}
+			prevSlug, prevTitle sql.NullString
+			nextSlug, nextTitle sql.NullString
+		)
+		if err := rows.Scan(&part.Slug, &part.Title, &part.Part, &part.Total,
+			&prevSlug, &prevTitle, &nextSlug, &nextTitle); err != nil {
+			return nil, xerrors.New(err)
+		}
+		if prevSlug.Valid {
+			part.Previous = &models.SeriesArticleLink{Slug: prevSlug.String, Title: prevTitle.String}
+		}
+		if nextSlug.Valid {
+			part.Next = &models.SeriesArticleLink{Slug: nextSlug.String, Title: nextTitle.String}
+		}
+		return part, nil
+	}, articleId)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, nil
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return part, nil
+}
+
+// removeArticleFromSeries takes the article out of its series, if it is part of one, and moves the later
+// parts forward. It is expected to run in a transaction, which keeps the series locked until it ends.
+func (c *Core) removeArticleFromSeries(ctx context.Context, articleId int64) error {
+	seriesId, err := c.getArticleSeriesId(ctx, articleId)
+	if err != nil {
+		if errors.Is(err, ErrArticleNotInSeries) {
+			return nil
+		}
+		return err
+	}
+	if _, err := c.lockSeries(ctx, seriesId); err != nil {
+		return err
+	}
+
+	const deleteSQL = `
+		WITH removed AS (
+			DELETE FROM series_articles WHERE article_id = $1
+			RETURNING series_id, position
+		), compacted AS (
+			UPDATE series_articles AS sa
+			SET position = sa.position - 1
+			FROM removed AS r
+			WHERE sa.series_id = r.series_id AND sa.position > r.position
+		)
+		UPDATE series AS s SET updated_at = NOW() FROM removed AS r WHERE s.id = r.series_id
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, articleId); err != nil {
+		return xerrors.New(err)
+	}
+
+	return nil
+}
+
+// lockSeries locks the series against concurrent changes to its parts until the transaction ends and
+// returns how many parts it has.
+func (c *Core) lockSeries(ctx context.Context, seriesId int64) (int, error) {
+	const lockSQL = `
+		SELECT id FROM series WHERE id = $1 FOR UPDATE
+	`
+	if _, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, lockSQL, scanInt64, seriesId); err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return 0, xerrors.New(NoRecordFound)
+		}
+		return 0, xerrors.New(err)
+	}
+
+	const countSQL = `
+		SELECT COUNT(*) FROM series_articles WHERE series_id = $1
+	`
+	total, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, countSQL, scanInt64, seriesId)
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return int(total), nil
+}
+
+// getArticleSeriesId returns the series the article is part of, or ErrArticleNotInSeries.
+func (c *Core) getArticleSeriesId(ctx context.Context, articleId int64) (int64, error) {
+	const selectSQL = `
+		SELECT series_id FROM series_articles WHERE article_id = $1
+	`
+
+	seriesId, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanInt64, articleId)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return 0, xerrors.New(ErrArticleNotInSeries)
+		}
+		return 0, xerrors.New(err)
+	}
+
+	return seriesId, nil
+}
@@ -3,45 +3,74 @@ package core
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
 	"github.com/siahsang/blog/internal/utils/collectionutils"
 	"github.com/siahsang/blog/internal/utils/databaseutils"
 	"github.com/siahsang/blog/internal/utils/functional"
 	"github.com/siahsang/blog/models"
+	"slices"
 	"strings"
+	"time"
 )
 
+var (
+	ErrDuplicateTag       = xerrors.Message("a tag with this name already exists, merge the tags instead")
+	ErrTagAliasInUse      = xerrors.Message("the name is already an alias of another tag")
+	ErrMergeTagIntoItself = xerrors.Message("a tag can't be merged into itself")
+	TagIsAlreadyFollowed  = xerrors.Message("Tag is already followed")
+	TagIsNotFollowed      = xerrors.Message("Tag is not followed")
+)
+
+// CreateTag returns the tags of the canonical names, creating the missing ones with their display name.
+// A name that is an alias resolves to its tag, and names resolving to the same tag are returned once.
 func (c *Core) CreateTag(context context.Context, tags []*models.Tag) ([]*models.Tag, error) {
 
 	if len(tags) == 0 {
-		return nil, xerrors.New("No tags provided")
+		return []*models.Tag{}, nil
+	}
+
+	aliasedNames, err := c.resolveTagAliases(context, functional.Map(tags, func(tag *models.Tag) string {
+		return tag.Name
+	}))
+	if err != nil {
+		return nil, err
 	}
 
-	// The SQL statement will look like: INSERT INTO tags (name) VALUES ($1), ($2), ...
+	// The SQL statement will look like: INSERT INTO tags (name, display_name) VALUES ($1, $2), ($3, $4), ...
+	// A name may only appear once, ON CONFLICT can't update the same row twice.
 	valueString := make([]string, 0, len(tags))
 	valueArgs := make([]any, 0, len(tags)*2)
+	seenNames := map[string]bool{}
 
-	for i, tag := range tags {
-		valueString = append(valueString, fmt.Sprintf("($%d)", i+1))
-		valueArgs = append(valueArgs, tag.Name)
+	for _, tag := range tags {
+		name := collectionutils.GetOrDefault(aliasedNames, tag.Name, tag.Name)
+		if seenNames[name] {
+			continue
+		}
+		seenNames[name] = true
+		valueArgs = append(valueArgs, name, tag.DisplayName)
+		valueString = append(valueString, fmt.Sprintf("($%d, $%d)", len(valueArgs)-1, len(valueArgs)))
 	}
 
 	// Join the value strings to create the full VALUES clause.
-	// e.g., "($1),($2),($3)"
+	// e.g., "($1, $2),($3, $4)"
 	valueCluses := strings.Join(valueString, ", ")
 
 	// Construct the full SQL statement.
 	insertSQL := fmt.Sprintf(`
-			INSERT INTO tags (name)
+			INSERT INTO tags (name, display_name)
 		  	VALUES %s	
-		  	ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
-		  	RETURNING id, name
+		  	ON CONFLICT (name) DO UPDATE SET last_used_at = NOW()
+		  	RETURNING id, name, display_name
 `, valueCluses)
 
 	tagList, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, insertSQL, func(rows *sql.Rows) (*models.Tag, error) {
 		tag := &models.Tag{}
-		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.DisplayName); err != nil {
 			return nil, xerrors.Newf("failed to scan returned tag: %w", err)
 		}
 
@@ -59,20 +88,52 @@ func (c *Core) CreateTag(context context.Context, tags []*models.Tag) ([]*models
 		return tag.Name, tag
 	})
 
-	resultTags := make([]*models.Tag, 0, len(tags))
+	resultTags := make([]*models.Tag, 0, len(tagList))
 	for _, tag := range tags {
-		if existingTag, exists := returnTagsMap[tag.Name]; exists {
-			tag.ID = existingTag.ID // Assign the ID from the database tag
-			resultTags = append(resultTags, existingTag)
-		} else {
+		name := collectionutils.GetOrDefault(aliasedNames, tag.Name, tag.Name)
+		existingTag, exists := returnTagsMap[name]
+		if !exists {
 			return nil, xerrors.Newf("tag %s not found in database", tag.Name)
 		}
+		tag.ID = existingTag.ID // Assign the ID from the database tag
+		if !slices.Contains(resultTags, existingTag) {
+			resultTags = append(resultTags, existingTag)
+		}
 	}
 
 	return resultTags, nil
 
 }
 
+// resolveTagAliases maps the names that are aliases to the name of their tag.
+func (c *Core) resolveTagAliases(ctx context.Context, names []string) (map[string]string, error) {
+	const selectSQL = `
+		SELECT ta.alias, t.name
+		FROM tag_aliases AS ta
+		    JOIN tags AS t ON t.id = ta.tag_id
+		WHERE ta.alias = ANY($1)
+	`
+
+	type aliasedName struct {
+		Alias string
+		Name  string
+	}
+	aliasedNames, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (aliasedName, error) {
+		var result aliasedName
+		if err := rows.Scan(&result.Alias, &result.Name); err != nil {
+			return aliasedName{}, xerrors.New(err)
+		}
+		return result, nil
+	}, pq.Array(names))
+	if err != nil {
+		return nil, xerrors.Newf("failed to resolve tag aliases: %w", err)
+	}
+
+	return collectionutils.Associate(aliasedNames, func(item aliasedName) (string, string) {
+		return item.Alias, item.Name
+	}), nil
+}
+
 func (c *Core) GetTagsByArticleId(context context.Context, articleIdList []int64) (map[int64][]models.Tag, error) {
 	if len(articleIdList) == 0 {
 		return make(map[int64][]models.Tag), nil
@@ -87,21 +148,22 @@ func (c *Core) GetTagsByArticleId(context context.Context, articleIdList []int64
 	}
 
 	query := fmt.Sprintf(`
-		SELECT at.article_id, t.id, t.name
+		SELECT at.article_id, t.id, t.name, t.display_name
 		FROM articles_tags at
 		JOIN tags t ON at.tag_id = t.id
 		WHERE at.article_id IN (%s)
 	`, strings.Join(placeholders, ", "))
 
 	type QueryTempResult struct {
-		ArticleID int64
-		TagID     int64
-		TagName   string
+		ArticleID      int64
+		TagID          int64
+		TagName        string
+		TagDisplayName string
 	}
 
 	foundArticleList, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (QueryTempResult, error) {
 		queryTempResult := QueryTempResult{}
-		if err := rows.Scan(&queryTempResult.ArticleID, &queryTempResult.TagID, &queryTempResult.TagName); err != nil {
+		if err := rows.Scan(&queryTempResult.ArticleID, &queryTempResult.TagID, &queryTempResult.TagName, &queryTempResult.TagDisplayName); err != nil {
 			return QueryTempResult{}, xerrors.Newf("failed to scan row: %w", err)
 		}
 		return queryTempResult, nil
@@ -119,8 +181,9 @@ func (c *Core) GetTagsByArticleId(context context.Context, articleIdList []int64
 	for key, value := range resultGroupByArticleId {
 		tagList := functional.Map(value, func(item QueryTempResult) models.Tag {
 			return models.Tag{
-				ID:   item.TagID,
-				Name: item.TagName,
+				ID:          item.TagID,
+				Name:        item.TagName,
+				DisplayName: item.TagDisplayName,
 			}
 		})
 
@@ -130,23 +193,312 @@ func (c *Core) GetTagsByArticleId(context context.Context, articleIdList []int64
 	return result, nil
 }
 
-func (c *Core) GetTagsList(context context.Context) ([]*models.Tag, error) {
+// GetTagsList returns the tags of the articles the viewer can see, the most used first, with the number
+// of those articles. A limit of 0 returns every tag.
+func (c *Core) GetTagsList(context context.Context, viewer *auth.User, limit int64) ([]*models.Tag, error) {
 	query := `
-		SELECT  id, name
-		FROM tags
+		SELECT t.id, t.name, t.display_name, t.description, COUNT(*) AS articles_count
+		FROM tags AS t
+		    JOIN articles_tags AS at ON at.tag_id = t.id
+		    JOIN articles AS a ON a.id = at.article_id
+		    JOIN users AS u ON u.id = a.author_id
+		WHERE u.deleted_at IS NULL AND ` + articleVisibilityClause("$1") + `
+		GROUP BY t.id
+		ORDER BY articles_count DESC, t.name
+		LIMIT NULLIF($2, 0)
 	`
 
 	foundTagList, err := databaseutils.ExecuteQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (*models.Tag, error) {
 		queryTempResult := &models.Tag{}
-		if err := rows.Scan(&queryTempResult.ID, &queryTempResult.Name); err != nil {
+		if err := rows.Scan(&queryTempResult.ID, &queryTempResult.Name, &queryTempResult.DisplayName, &queryTempResult.Description,
+			&queryTempResult.ArticlesCount); err != nil {
 			return nil, xerrors.Newf("failed to scan row: %w", err)
 		}
 		return queryTempResult, nil
-	})
+	}, viewerId(viewer), limit)
 
 	if err != nil {
-		return nil, xerrors.Newf("failed to query tags by article ids: %w", err)
+		return nil, xerrors.Newf("failed to query tags: %w", err)
 	}
 
 	return foundTagList, nil
 }
+
+// GetTagByName returns the tag with its aliases and the number of all articles tagged with it.
+func (c *Core) GetTagByName(ctx context.Context, name string) (*models.Tag, error) {
+	const selectSQL = `
+		SELECT t.id, t.name, t.display_name, t.description,
+		       (SELECT COUNT(*) FROM articles_tags AS at WHERE at.tag_id = t.id),
+		       ARRAY(SELECT ta.alias FROM tag_aliases AS ta WHERE ta.tag_id = t.id ORDER BY ta.alias)
+		FROM tags AS t
+		WHERE t.name = $1
+	`
+
+	tag, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*models.Tag, error) {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.DisplayName, &tag.Description, &tag.ArticlesCount, pq.Array(&tag.Aliases)); err != nil {
+			return nil, xerrors.Newf("failed to scan row: %w", err)
+		}
+		return tag, nil
+	}, name)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return tag, nil
+}
+
+// UpdateTag saves the names and description of the tag. A renamed tag keeps its old name as an alias,
+// so articles tagged with it later still end up with the tag.
+func (c *Core) UpdateTag(ctx context.Context, tag *models.Tag) (*models.Tag, error) {
+	const selectSQL = `
+		SELECT name FROM tags WHERE id = $1 FOR UPDATE
+	`
+	oldName, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanString, tag.ID)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	if oldName != tag.Name {
+		if err := c.checkTagNameAvailable(ctx, tag.Name, tag.ID); err != nil {
+			return nil, err
+		}
+
+		// the new name may have been an alias of the tag itself
+		const deleteAliasSQL = `
+			DELETE FROM tag_aliases WHERE alias = $1
+		`
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteAliasSQL, tag.Name); err != nil {
+			return nil, xerrors.New(err)
+		}
+	}
+
+	const updateSQL = `
+		UPDATE tags SET name = $2, display_name = $3, description = $4 WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateSQL, tag.ID, tag.Name, tag.DisplayName, tag.Description); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	if oldName != tag.Name {
+		if err := c.insertTagAlias(ctx, oldName, tag.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.GetTagByName(ctx, tag.Name)
+}
+
+// CreateTagAlias makes the alias resolve to the tag. A name that is a tag of its own can't become an
+// alias, the tags have to be merged instead.
+func (c *Core) CreateTagAlias(ctx context.Context, tag *models.Tag, alias string) (*models.Tag, error) {
+	if err := c.checkTagNameAvailable(ctx, alias, tag.ID); err != nil {
+		return nil, err
+	}
+	if err := c.insertTagAlias(ctx, alias, tag.ID); err != nil {
+		return nil, err
+	}
+
+	return c.GetTagByName(ctx, tag.Name)
+}
+
+func (c *Core) DeleteTagAlias(ctx context.Context, tag *models.Tag, alias string) (*models.Tag, error) {
+	const deleteSQL = `
+		DELETE FROM tag_aliases WHERE alias = $1 AND tag_id = $2
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, alias, tag.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	if rowsAffected == 0 {
+		return nil, xerrors.New(NoRecordFound)
+	}
+
+	return c.GetTagByName(ctx, tag.Name)
+}
+
+// MergeTags moves the articles, aliases and followers of source to target and deletes source, whose name becomes
+// an alias of target. It is expected to run in a transaction.
+func (c *Core) MergeTags(ctx context.Context, source *models.Tag, target *models.Tag) (*models.Tag, error) {
+	if source.ID == target.ID {
+		return nil, xerrors.New(ErrMergeTagIntoItself)
+	}
+
+	statements := []struct {
+		sql  string
+		args []any
+	}{
+		{`
+			INSERT INTO articles_tags (article_id, tag_id)
+			SELECT article_id, $2 FROM articles_tags WHERE tag_id = $1
+			ON CONFLICT DO NOTHING
+		`, []any{source.ID, target.ID}},
+		{`
+			UPDATE tag_aliases SET tag_id = $2 WHERE tag_id = $1
+		`, []any{source.ID, target.ID}},
+		{`
+			INSERT INTO tag_follows (user_id, tag_id, created_at)
+			SELECT user_id, $2, created_at FROM tag_follows WHERE tag_id = $1
+			ON CONFLICT DO NOTHING
+		`, []any{source.ID, target.ID}},
+		{`
+			UPDATE tags SET description = $2 WHERE id = $1 AND description = ''
+		`, []any{target.ID, source.Description}},
+		// cascades to the remaining articles_tags rows of source
+		{`
+			DELETE FROM tags WHERE id = $1
+		`, []any{source.ID}},
+	}
+	for _, statement := range statements {
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, statement.sql, statement.args...); err != nil {
+			return nil, xerrors.New(err)
+		}
+	}
+
+	if err := c.insertTagAlias(ctx, source.Name, target.ID); err != nil {
+		return nil, err
+	}
+
+	return c.GetTagByName(ctx, target.Name)
+}
+
+// DeleteOrphanTags deletes the tags no article uses, unless they were curated with a description or
+// aliases, are followed or were used within the grace period.
+func (c *Core) DeleteOrphanTags(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	const deleteSQL = `
+		DELETE FROM tags AS t
+		WHERE t.last_used_at < $1
+		  AND t.description = ''
+		  AND NOT EXISTS (SELECT 1 FROM articles_tags AS at WHERE at.tag_id = t.id)
+		  AND NOT EXISTS (SELECT 1 FROM tag_aliases AS ta WHERE ta.tag_id = t.id)
+		  AND NOT EXISTS (SELECT 1 FROM tag_follows AS tf WHERE tf.tag_id = t.id)
+	`
+	deleted, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, time.Now().Add(-gracePeriod))
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return deleted, nil
+}
+
+// checkTagNameAvailable fails when name is another tag or an alias of another tag.
+func (c *Core) checkTagNameAvailable(ctx context.Context, name string, tagId int64) error {
+	const selectSQL = `
+		SELECT EXISTS(SELECT 1 FROM tags WHERE name = $1 AND id <> $2),
+		       EXISTS(SELECT 1 FROM tag_aliases WHERE alias = $1 AND tag_id <> $2)
+	`
+
+	type availability struct {
+		TagExists   bool
+		AliasExists bool
+	}
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (availability, error) {
+		var result availability
+		if err := rows.Scan(&result.TagExists, &result.AliasExists); err != nil {
+			return availability{}, xerrors.New(err)
+		}
+		return result, nil
+	}, name, tagId)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	switch {
+	case result.TagExists:
+		return xerrors.New(ErrDuplicateTag)
+	case result.AliasExists:
+		return xerrors.New(ErrTagAliasInUse)
+	}
+	return nil
+}
+
+func (c *Core) insertTagAlias(ctx context.Context, alias string, tagId int64) error {
+	const insertSQL = `
+		INSERT INTO tag_aliases (alias, tag_id) VALUES ($1, $2)
+		ON CONFLICT (alias) DO UPDATE SET tag_id = EXCLUDED.tag_id
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, alias, tagId); err != nil {
+		return xerrors.New(err)
+	}
+	return nil
+}
+
+// GetTagByNameOrAlias returns the tag with the canonical name, or the tag the name is an alias of.
+func (c *Core) GetTagByNameOrAlias(ctx context.Context, name string) (*models.Tag, error) {
+	aliasedNames, err := c.resolveTagAliases(ctx, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	return c.GetTagByName(ctx, collectionutils.GetOrDefault(aliasedNames, name, name))
+}
+
+func (c *Core) FollowTag(ctx context.Context, user *auth.User, name string) (*models.Tag, error) {
+	tag, err := c.GetTagByNameOrAlias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	const insertSQL = `
+		INSERT INTO tag_follows (user_id, tag_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, user.ID, tag.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	if rowsAffected == 0 {
+		return nil, xerrors.New(TagIsAlreadyFollowed)
+	}
+
+	return tag, nil
+}
+
+func (c *Core) UnfollowTag(ctx context.Context, user *auth.User, name string) (*models.Tag, error) {
+	tag, err := c.GetTagByNameOrAlias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	const deleteSQL = `
+		DELETE FROM tag_follows WHERE user_id = $1 AND tag_id = $2
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, user.ID, tag.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	if rowsAffected == 0 {
+		return nil, xerrors.New(TagIsNotFollowed)
+	}
+
+	return tag, nil
+}
+
+// GetFollowedTags returns the tags the user follows in alphabetical order.
+func (c *Core) GetFollowedTags(ctx context.Context, user *auth.User) ([]*models.Tag, error) {
+	const selectSQL = `
+		SELECT t.id, t.name, t.display_name, t.description
+		FROM tag_follows AS tf
+		    JOIN tags AS t ON t.id = tf.tag_id
+		WHERE tf.user_id = $1
+		ORDER BY t.name
+	`
+
+	tags, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*models.Tag, error) {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.DisplayName, &tag.Description); err != nil {
+			return nil, xerrors.New(err)
+		}
+		return tag, nil
+	}, user.ID)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/auth"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// Weights of the engagement an article receives. Engagement by the author doesn't count, views by the
+// author aren't counted to begin with.
+const (
+	trendingFavoriteWeight = 3.0
+	trendingCommentWeight  = 2.0
+	trendingViewWeight     = 0.1
+)
+
+// RefreshTrending recomputes the trending articles and tags from the engagement within window before
+// now. Every view, favorite, comment or newly tagged article counts less the older it is, halving every
+// halfLife. It is expected to run in a transaction, so readers keep seeing the previous ranking until
+// it commits.
+func (c *Core) RefreshTrending(ctx context.Context, now time.Time, window time.Duration, halfLife time.Duration) error {
+	since := now.Add(-window)
+	halfLifeSeconds := halfLife.Seconds()
+
+	statements := []struct {
+		sql  string
+		args []any
+	}{
+		{`DELETE FROM trending_articles`, nil},
+		{fmt.Sprintf(`
+			INSERT INTO trending_articles (article_id, score, computed_at)
+			SELECT e.article_id, SUM(e.weight * POWER(0.5, EXTRACT(EPOCH FROM ($1::timestamptz - e.created_at))::float8 / $3)), $1
+			FROM (
+				SELECT fa.article_id, fa.created_at, %[1]f AS weight
+				FROM favourite_articles AS fa
+				    JOIN articles AS a ON a.id = fa.article_id
+				WHERE fa.created_at > $2 AND fa.user_id <> a.author_id
+				UNION ALL
+				SELECT cm.article_id, cm.created_at, %[2]f AS weight
+				FROM comments AS cm
+				    JOIN articles AS a ON a.id = cm.article_id
+				WHERE cm.created_at > $2 AND cm.author_id <> a.author_id
+				UNION ALL
+				-- views are counted per day, as if they all happened at its start
+				SELECT vw.article_id, vw.day::timestamp AT TIME ZONE 'UTC', vw.views * %[3]f AS weight
+				FROM article_daily_views AS vw
+				WHERE vw.day::timestamp AT TIME ZONE 'UTC' > $2
+			) AS e
+			GROUP BY e.article_id
+		`, trendingFavoriteWeight, trendingCommentWeight, trendingViewWeight), []any{now, since, halfLifeSeconds}},
+		{`DELETE FROM trending_tags`, nil},
+		// tags rank by the articles recently published with them, private and deleted authors left out
+		{`
+			INSERT INTO trending_tags (tag_id, score, articles_count, computed_at)
+			SELECT at.tag_id, SUM(POWER(0.5, EXTRACT(EPOCH FROM ($1::timestamptz - a.created_at))::float8 / $3)), COUNT(*), $1
+			FROM articles_tags AS at
+			    JOIN articles AS a ON a.id = at.article_id
+			    JOIN users AS u ON u.id = a.author_id
+			WHERE a.created_at > $2 AND u.deleted_at IS NULL AND NOT u.is_private
+			GROUP BY at.tag_id
+		`, []any{now, since, halfLifeSeconds}},
+	}
+	for _, statement := range statements {
+		if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, statement.sql, statement.args...); err != nil {
+			return xerrors.New(err)
+		}
+	}
+
+	return nil
+}
+
+// GetTrendingArticles returns the trending articles the viewer can see, the highest score first.
+func (c *Core) GetTrendingArticles(ctx context.Context, filter filter.Filter, viewer *auth.User) ([]*models.Article, error) {
+	selectSQL := `
+		SELECT ` + articleColumns + `
+		FROM trending_articles AS ta
+		    JOIN articles AS a ON a.id = ta.article_id
+		    JOIN users AS u ON u.id = a.author_id
+		WHERE u.deleted_at IS NULL
+		  AND ` + articleVisibilityClause("$1") + `
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes AS m WHERE m.muter_id = $1 AND m.muted_id = a.author_id)
+		ORDER BY ta.score DESC, a.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	articles, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanArticle, viewerId(viewer), filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return articles, nil
+}
+
+// GetTrendingTags returns the trending tags, the highest score first, with the number of articles
+// recently published with them.
+func (c *Core) GetTrendingTags(ctx context.Context, limit int64) ([]*models.Tag, error) {
+	const selectSQL = `
+		SELECT t.id, t.name, t.display_name, t.description, tt.articles_count
+		FROM trending_tags AS tt
+		    JOIN tags AS t ON t.id = tt.tag_id
+		ORDER BY tt.score DESC, t.name
+		LIMIT NULLIF($1, 0)
+	`
+
+	tags, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, func(rows *sql.Rows) (*models.Tag, error) {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.DisplayName, &tag.Description, &tag.ArticlesCount); err != nil {
+			return nil, xerrors.New(err)
+		}
+		return tag, nil
+	}, limit)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/models"
+)
+
+// CreateUpload records an image whose original and thumbnails are already in the storage.
+func (c *Core) CreateUpload(ctx context.Context, upload *models.Upload) (*models.Upload, error) {
+	variants, err := json.Marshal(upload.Variants)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const insertSQL = `
+		INSERT INTO uploads (user_id, key, content_type, size, width, height, variants)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, user_id, key, content_type, size, width, height, variants, created_at
+	`
+	created, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, insertSQL, scanUpload,
+		upload.UserID, upload.Key, upload.ContentType, upload.Size, upload.Width, upload.Height, variants)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return created, nil
+}
+
+// GetUploadsByUserId returns every upload of the user, newest first.
+func (c *Core) GetUploadsByUserId(ctx context.Context, userId int64) ([]*models.Upload, error) {
+	const selectSQL = `
+		SELECT id, user_id, key, content_type, size, width, height, variants, created_at
+		FROM uploads
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+	uploads, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanUpload, userId)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return uploads, nil
+}
+
+func scanUpload(rows *sql.Rows) (*models.Upload, error) {
+	var (
+		upload   = &models.Upload{}
+		variants []byte
+	)
+	if err := rows.Scan(&upload.ID, &upload.UserID, &upload.Key, &upload.ContentType, &upload.Size,
+		&upload.Width, &upload.Height, &variants, &upload.CreatedAt); err != nil {
+		return nil, xerrors.New(err)
+	}
+	if err := json.Unmarshal(variants, &upload.Variants); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return upload, nil
+}
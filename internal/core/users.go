@@ -48,9 +48,9 @@ func (c *Core) CreateNewUser(context context.Context, user *auth.User) error {
 
 func (c *Core) GetUserByEmail(context context.Context, email string) (*auth.User, error) {
 	query := `
-		SELECT id, email, username, password, bio, image
+		SELECT id, email, username, password, bio, image, is_private, is_admin, deleted_at
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND NOT anonymized
 	`
 
 	user, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (*auth.User, error) {
@@ -63,6 +63,9 @@ func (c *Core) GetUserByEmail(context context.Context, email string) (*auth.User
 			&user.Password,
 			&user.Bio,
 			&user.Image,
+			&user.IsPrivate,
+			&user.IsAdmin,
+			&user.DeletedAt,
 		); err != nil {
 			return nil, xerrors.New(err)
 		}
@@ -71,7 +74,7 @@ func (c *Core) GetUserByEmail(context context.Context, email string) (*auth.User
 
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, databaseutils.ErrNoRowsFound):
 			return nil, xerrors.New(NoRecordFound)
 		default:
 			return nil, xerrors.New(err)
@@ -83,9 +86,9 @@ func (c *Core) GetUserByEmail(context context.Context, email string) (*auth.User
 
 func (c *Core) GetUserByUsername(context context.Context, username string) (*auth.User, error) {
 	query := `
-		SELECT id, email, username, password, bio, image
+		SELECT id, email, username, password, bio, image, is_private
 		FROM users
-		WHERE username = $1
+		WHERE username = $1 AND deleted_at IS NULL
 	`
 
 	user, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (*auth.User, error) {
@@ -98,6 +101,7 @@ func (c *Core) GetUserByUsername(context context.Context, username string) (*aut
 			&user.Password,
 			&user.Bio,
 			&user.Image,
+			&user.IsPrivate,
 		); err != nil {
 			return nil, xerrors.New(err)
 		}
@@ -106,7 +110,7 @@ func (c *Core) GetUserByUsername(context context.Context, username string) (*aut
 
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, databaseutils.ErrNoRowsFound):
 			return nil, xerrors.New(NoRecordFound)
 		default:
 			return nil, xerrors.New(err)
@@ -123,7 +127,7 @@ func (c *Core) GetUsersByIdList(context context.Context, userIdList []int64) ([]
 
 	placeholders, args := stringutils.INCluse(userIdList)
 	query := fmt.Sprintf(`
-		SELECT id, email, username, password, bio, image
+		SELECT id, email, username, password, bio, image, is_private
 		FROM users
 		WHERE id in (%s)
 	`, strings.Join(placeholders, ", "))
@@ -136,7 +140,8 @@ func (c *Core) GetUsersByIdList(context context.Context, userIdList []int64) ([]
 			&user.Username,
 			&user.Password,
 			&user.Bio,
-			&user.Image); err != nil {
+			&user.Image,
+			&user.IsPrivate); err != nil {
 			return nil, xerrors.New(err)
 		}
 		return user, nil
@@ -163,22 +168,22 @@ func (c *Core) GetUsersById(ctx context.Context, userId int64) (*auth.User, erro
 func (c *Core) UpdateUser(context context.Context, user *auth.User) (*auth.User, error) {
 	query := `
 		UPDATE users
-		SET bio = $1,image= $2
-		WHERE id = $3
-		RETURNING id, email, username, bio, image 
+		SET bio = $1,image= $2, is_private = $3
+		WHERE id = $4
+		RETURNING id, email, username, bio, image, is_private
 		
 	`
 
-	args := []any{user.Bio, user.Image, user.ID}
+	args := []any{user.Bio, user.Image, user.IsPrivate, user.ID}
 	returningUser, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, context, query, func(rows *sql.Rows) (*auth.User, error) {
 		var user = &auth.User{}
 
 		if err := rows.Scan(&user.ID,
-			&user.ID,
 			&user.Email,
 			&user.Username,
 			&user.Bio,
-			&user.Image); err != nil {
+			&user.Image,
+			&user.IsPrivate); err != nil {
 			return nil, xerrors.New(err)
 		}
 		return user, nil
@@ -186,13 +191,20 @@ func (c *Core) UpdateUser(context context.Context, user *auth.User) (*auth.User,
 
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, databaseutils.ErrNoRowsFound):
 			return nil, xerrors.New(NoRecordFound)
 		default:
 			return nil, xerrors.New(err)
 		}
 	}
 
+	// a public profile has nobody to approve follow requests, so pending ones are accepted
+	if !returningUser.IsPrivate {
+		if err := c.approveAllFollowRequests(context, returningUser.ID); err != nil {
+			return nil, xerrors.New(err)
+		}
+	}
+
 	c.log.Info("User updated Successfully", "user_id", returningUser.ID, "email", returningUser.Email)
 	return returningUser, nil
 }
@@ -0,0 +1,336 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/webhooks"
+	"github.com/siahsang/blog/models"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+const webhookColumns = `
+	id, user_id, url, secret, events, is_global, active, consecutive_failures, disabled_at, created_at, updated_at
+`
+
+const webhookDeliveryColumns = `
+	id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at
+`
+
+// DueWebhookDelivery is a delivery claimed by the dispatcher together with where to send it.
+type DueWebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	Event     string
+	Payload   []byte
+	Attempts  int
+	URL       string
+	Secret    string
+}
+
+func (c *Core) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	const insertSQL = `
+		INSERT INTO webhooks (user_id, url, secret, events, is_global)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + webhookColumns
+
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, insertSQL, scanWebhook,
+		webhook.UserID, webhook.URL, webhook.Secret, webhookEvents(webhook), webhook.Global)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+func (c *Core) GetWebhooks(ctx context.Context, userId int64) ([]*models.Webhook, error) {
+	const selectSQL = `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanWebhook, userId)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// GetWebhook returns the webhook if it belongs to the user, or NoRecordFound.
+func (c *Core) GetWebhook(ctx context.Context, userId, webhookId int64) (*models.Webhook, error) {
+	const selectSQL = `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, selectSQL, scanWebhook, webhookId, userId)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// UpdateWebhook saves the url, events and active flag of the webhook. Activating a webhook that was
+// disabled after repeated failures gives it a fresh start.
+func (c *Core) UpdateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	const updateSQL = `
+		UPDATE webhooks
+		SET url                  = $1,
+		    events               = $2,
+		    active               = $3,
+		    consecutive_failures = CASE WHEN $3 AND NOT active THEN 0 ELSE consecutive_failures END,
+		    disabled_at          = CASE WHEN $3 THEN NULL ELSE disabled_at END,
+		    updated_at           = NOW()
+		WHERE id = $4 AND user_id = $5
+		RETURNING ` + webhookColumns
+
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, updateSQL, scanWebhook,
+		webhook.URL, webhookEvents(webhook), webhook.Active, webhook.ID, webhook.UserID)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+func (c *Core) DeleteWebhook(ctx context.Context, userId, webhookId int64) error {
+	const deleteSQL = `
+		DELETE FROM webhooks WHERE id = $1 AND user_id = $2
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, deleteSQL, webhookId, userId)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.New(NoRecordFound)
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues the payload for every active webhook interested in the event: the
+// webhooks of the user owning the content and the global ones. It returns the number of deliveries.
+func (c *Core) EnqueueWebhookDeliveries(ctx context.Context, ownerId int64, event string, payload []byte) (int64, error) {
+	const insertSQL = `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT wh.id, $1, $2
+		FROM webhooks AS wh
+		    JOIN users AS u ON u.id = wh.user_id
+		WHERE wh.active
+		  AND (wh.is_global OR wh.user_id = $3)
+		  AND (cardinality(wh.events) = 0 OR $1 = ANY (wh.events))
+		  -- webhooks of accounts pending deletion or anonymized stop firing
+		  AND u.deleted_at IS NULL AND NOT u.anonymized
+	`
+
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, insertSQL, event, string(payload), ownerId)
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+
+	return rowsAffected, nil
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, newest first.
+func (c *Core) GetWebhookDeliveries(ctx context.Context, webhookId int64, filter filter.Filter) ([]*models.WebhookDelivery, error) {
+	const selectSQL = `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, selectSQL, scanWebhookDelivery, webhookId, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// ReplayWebhookDelivery queues a new delivery with the payload of an earlier one.
+func (c *Core) ReplayWebhookDelivery(ctx context.Context, webhookId, deliveryId int64) (*models.WebhookDelivery, error) {
+	const insertSQL = `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, event, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING ` + webhookDeliveryColumns
+
+	result, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, insertSQL, scanWebhookDelivery, deliveryId, webhookId)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, xerrors.New(NoRecordFound)
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// ClaimDueWebhookDeliveries picks up to limit pending deliveries that are due and counts the attempt.
+// Their next attempt is pushed back by lease, so a dispatcher that dies mid-delivery only delays
+// them, and concurrent dispatchers never pick the same delivery.
+func (c *Core) ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*DueWebhookDelivery, error) {
+	const claimSQL = `
+		WITH due AS (
+		    SELECT d.id
+		    FROM webhook_deliveries AS d
+		        JOIN webhooks AS w ON d.webhook_id = w.id
+		    WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.active
+		    ORDER BY d.next_attempt_at
+		    LIMIT $1
+		    FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries AS d
+		SET attempts        = d.attempts + 1,
+		    next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, webhooks AS w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret
+	`
+
+	result, err := databaseutils.ExecuteQuery(c.sqlTemplate, ctx, claimSQL, func(rows *sql.Rows) (*DueWebhookDelivery, error) {
+		delivery := &DueWebhookDelivery{}
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload,
+			&delivery.Attempts, &delivery.URL, &delivery.Secret); err != nil {
+			return nil, xerrors.New(err)
+		}
+		return delivery, nil
+	}, limit, lease.Seconds())
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+func (c *Core) MarkWebhookDeliverySucceeded(ctx context.Context, delivery *DueWebhookDelivery, statusCode int) error {
+	const updateDeliverySQL = `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', last_status_code = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateDeliverySQL, delivery.ID, statusCode); err != nil {
+		return xerrors.New(err)
+	}
+
+	const resetFailuresSQL = `
+		UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures > 0
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, resetFailuresSQL, delivery.WebhookID); err != nil {
+		return xerrors.New(err)
+	}
+
+	return nil
+}
+
+// MarkWebhookDeliveryFailed records a failed attempt. The delivery is retried at retryAt, or given up
+// when retryAt is nil. The webhook is disabled once the policy says so; the return value tells whether
+// that happened now.
+func (c *Core) MarkWebhookDeliveryFailed(ctx context.Context, delivery *DueWebhookDelivery, statusCode int, deliveryErr error,
+	retryAt *time.Time, policy webhooks.Policy) (bool, error) {
+	var lastStatusCode *int
+	if statusCode != 0 {
+		lastStatusCode = &statusCode
+	}
+
+	const updateDeliverySQL = `
+		UPDATE webhook_deliveries
+		SET status           = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		    next_attempt_at  = COALESCE($2, next_attempt_at),
+		    last_status_code = $3,
+		    last_error       = $4
+		WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, updateDeliverySQL,
+		delivery.ID, retryAt, lastStatusCode, deliveryErr.Error()); err != nil {
+		return false, xerrors.New(err)
+	}
+
+	const updateWebhookSQL = `
+		UPDATE webhooks
+		SET consecutive_failures = consecutive_failures + 1
+		WHERE id = $1 AND active
+		RETURNING consecutive_failures
+	`
+	consecutiveFailures, err := databaseutils.ExecuteSingleQuery(c.sqlTemplate, ctx, updateWebhookSQL, scanInt64, delivery.WebhookID)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			// disabled in the meantime
+			return false, nil
+		}
+		return false, xerrors.New(err)
+	}
+
+	if !policy.Disables(int(consecutiveFailures)) {
+		return false, nil
+	}
+
+	const disableWebhookSQL = `
+		UPDATE webhooks
+		SET active = FALSE, disabled_at = NOW()
+		WHERE id = $1 AND active
+	`
+	rowsAffected, err := databaseutils.ExecuteNonQuery(c.sqlTemplate, ctx, disableWebhookSQL, delivery.WebhookID)
+	if err != nil {
+		return false, xerrors.New(err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// webhookEvents returns the events column of the webhook, which is an empty array rather than NULL
+// when the webhook wants every event.
+func webhookEvents(webhook *models.Webhook) any {
+	if webhook.Events == nil {
+		return pq.Array([]string{})
+	}
+	return pq.Array(webhook.Events)
+}
+
+func scanWebhook(rows *sql.Rows) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, pq.Array(&webhook.Events),
+		&webhook.Global, &webhook.Active, &webhook.ConsecutiveFailures, &webhook.DisabledAt,
+		&webhook.CreatedAt, &webhook.UpdatedAt); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return webhook, nil
+}
+
+func scanWebhookDelivery(rows *sql.Rows) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError,
+		&delivery.CreatedAt, &delivery.DeliveredAt); err != nil {
+		return nil, xerrors.New(err)
+	}
+	return delivery, nil
+}
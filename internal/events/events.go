@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	ArticleCreated     Type = "article.created"
+	ArticleUpdated     Type = "article.updated"
+	ArticlePublished   Type = "article.published"
+	ArticleDeleted     Type = "article.deleted"
+	CommentCreated     Type = "comment.created"
+	ArticleFavorited   Type = "article.favorited"
+	ArticleUnfavorited Type = "article.unfavorited"
+	UserFollowed       Type = "user.followed"
+	FollowRequested    Type = "user.follow_requested"
+	CoAuthorInvited    Type = "article.coauthor_invited"
+)
+
+// Event describes something that happened in the core. Fields that don't apply to the event type are zero.
+type Event struct {
+	// ID is the idempotency key of the event. It stays the same when the event is delivered again.
+	ID        string `json:"id,omitempty"`
+	Type      Type   `json:"type"`
+	ActorID   int64  `json:"actorId"`
+	ArticleID int64  `json:"articleId,omitempty"`
+	// ArticleSlug is only set on ArticleDeleted, since the article can't be looked up anymore.
+	ArticleSlug string    `json:"articleSlug,omitempty"`
+	CommentID   int64     `json:"commentId,omitempty"`
+	UserID      int64     `json:"userId,omitempty"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
+
+type Handler func(ctx context.Context, event Event) error
+
+// Bus delivers events to the subscribed handlers. Events reach it through the outbox relay, which
+// may deliver an event more than once, so handlers must tolerate duplicates.
+type Bus struct {
+	handlers []Handler
+	mutex    sync.RWMutex
+	log      *slog.Logger
+}
+
+func NewBus(log *slog.Logger) *Bus {
+	return &Bus{log: log}
+}
+
+func (bus *Bus) Subscribe(handler Handler) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.handlers = append(bus.handlers, handler)
+}
+
+// Dispatch calls every handler with the event, in subscription order. A failing handler doesn't stop
+// the others; the failures are returned together.
+func (bus *Bus) Dispatch(event Event) error {
+	bus.mutex.RLock()
+	handlers := bus.handlers
+	bus.mutex.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := bus.safeHandle(handler, event); err != nil {
+			bus.log.Error("event handler failed", "type", event.Type, "id", event.ID, "error", err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (bus *Bus) safeHandle(handler Handler, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in event handler: %v", r)
+		}
+	}()
+
+	// handlers run detached from whoever dispatches the event
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return handler(ctx, event)
+}
@@ -0,0 +1,169 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers GIF for image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+var (
+	ErrUnsupportedType = xerrors.Message("only JPEG, PNG and GIF images are supported")
+	ErrTooManyPixels   = xerrors.Message("image dimensions are too large")
+	ErrInvalidImage    = xerrors.Message("image can't be decoded")
+)
+
+// extensions of the supported content types, as sniffed from the data rather than trusted from the client
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Image is an uploaded image, validated and decoded.
+type Image struct {
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	image       image.Image
+}
+
+// Variant is the image scaled down to a width, encoded in the format of the original, or PNG for GIF.
+type Variant struct {
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Decode sniffs the type of the data and decodes it. The dimensions are checked before decoding, so a
+// small file claiming to be huge can't make the server allocate gigabytes.
+func Decode(data []byte, maxPixels int) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	extension, ok := extensions[contentType]
+	if !ok {
+		return nil, xerrors.New(ErrUnsupportedType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, xerrors.New(ErrInvalidImage)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, xerrors.New(ErrTooManyPixels)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, xerrors.New(ErrInvalidImage)
+	}
+
+	return &Image{
+		ContentType: contentType,
+		Extension:   extension,
+		Width:       config.Width,
+		Height:      config.Height,
+		image:       decoded,
+	}, nil
+}
+
+// Thumbnails scales the image down to each width that is narrower than the image, keeping its aspect ratio.
+func (img *Image) Thumbnails(widths []int) ([]*Variant, error) {
+	var (
+		variants []*Variant
+		// converted once for all the widths, a large image takes hundreds of megabytes as RGBA
+		source *image.RGBA
+	)
+	for _, width := range widths {
+		if width >= img.Width {
+			continue
+		}
+		if source == nil {
+			source = toRGBA(img.image)
+		}
+
+		height := max(1, img.Height*width/img.Width)
+		scaled := resize(source, width, height)
+
+		var (
+			buffer      bytes.Buffer
+			err         error
+			contentType = img.ContentType
+			extension   = img.Extension
+		)
+		switch img.ContentType {
+		case "image/jpeg":
+			err = jpeg.Encode(&buffer, scaled, &jpeg.Options{Quality: 85})
+		default:
+			// a GIF thumbnail is a still of the first frame, PNG keeps its colors without a palette
+			contentType, extension = "image/png", ".png"
+			err = png.Encode(&buffer, scaled)
+		}
+		if err != nil {
+			return nil, xerrors.New(err)
+		}
+
+		variants = append(variants, &Variant{
+			Width:       width,
+			Height:      height,
+			ContentType: contentType,
+			Extension:   extension,
+			Data:        buffer.Bytes(),
+		})
+	}
+	return variants, nil
+}
+
+// toRGBA returns the image as RGBA with its origin at 0,0, converting it unless it already is.
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+// resize scales source down to width x height by averaging the source pixels each target pixel covers.
+// Averaging premultiplied colors keeps transparent pixels from darkening the edges.
+func resize(source *image.RGBA, width, height int) *image.RGBA {
+	srcWidth, srcHeight := source.Rect.Dx(), source.Rect.Dy()
+	target := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := source.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(source.Pix[offset])
+					g += uint64(source.Pix[offset+1])
+					b += uint64(source.Pix[offset+2])
+					a += uint64(source.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+
+			offset := target.PixOffset(x, y)
+			target.Pix[offset] = uint8(r / count)
+			target.Pix[offset+1] = uint8(g / count)
+			target.Pix[offset+2] = uint8(b / count)
+			target.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return target
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek uint64
+	// anyDayOfMonth and anyDayOfWeek follow cron: when both day fields are restricted, either may match
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+var descriptors = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// ParseSchedule parses a standard five field cron expression (minute, hour, day of month, month and
+// day of week) or one of @yearly, @monthly, @weekly, @daily and @hourly. Fields accept *, lists,
+// ranges and steps, e.g. "*/15 9-17 * * 1-5".
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, xerrors.Newf("cron expression %q must have 5 fields", spec)
+	}
+
+	var (
+		schedule = &Schedule{}
+		err      error
+	)
+	if schedule.minutes, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfMonth, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	// 7 is accepted for sunday as well
+	if schedule.daysOfWeek, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfWeek&(1<<7) != 0 {
+		schedule.daysOfWeek |= 1
+	}
+	schedule.anyDayOfMonth = fields[2] == "*"
+	schedule.anyDayOfWeek = fields[4] == "*"
+
+	return schedule, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, found := strings.Cut(part, "/"); found {
+			var err error
+			if step, err = strconv.Atoi(after); err != nil || step <= 0 {
+				return 0, xerrors.Newf("invalid step in cron field %q", field)
+			}
+			rangePart = before
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			var err error
+			before, after, isRange := strings.Cut(rangePart, "-")
+			if start, err = strconv.Atoi(before); err != nil {
+				return 0, xerrors.Newf("invalid value in cron field %q", field)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(after); err != nil {
+					return 0, xerrors.Newf("invalid range in cron field %q", field)
+				}
+			} else if step > 1 {
+				// "5/10" means from 5 to the end, every 10
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, xerrors.Newf("cron field %q is out of range %d-%d", field, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t that matches the schedule, to the minute.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// every match falls within 5 years, the longest a day like february 29th on a monday can take
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.daysOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := s.daysOfWeek&(1<<t.Weekday()) != 0
+
+	switch {
+	case s.anyDayOfMonth && s.anyDayOfWeek:
+		return true
+	case s.anyDayOfMonth:
+		return dayOfWeek
+	case s.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
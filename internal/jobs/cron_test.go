@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleRejectsInvalidExpressions(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+		"@every",
+	}
+	for _, spec := range tests {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", date(2024, 3, 1, 10, 5), date(2024, 3, 1, 10, 6)},
+		{"seconds are dropped", "* * * * *", date(2024, 3, 1, 10, 5).Add(59 * time.Second), date(2024, 3, 1, 10, 6)},
+		{"strictly after", "0,30 8,20 * * *", date(2024, 3, 1, 8, 30), date(2024, 3, 1, 20, 0)},
+		{"list", "0,30 8,20 * * *", date(2024, 3, 1, 8, 10), date(2024, 3, 1, 8, 30)},
+		{"range", "0 9-17 * * *", date(2024, 3, 1, 17, 1), date(2024, 3, 2, 9, 0)},
+		{"step", "*/15 * * * *", date(2024, 3, 1, 10, 16), date(2024, 3, 1, 10, 30)},
+		{"step from a start", "5/20 * * * *", date(2024, 3, 1, 10, 6), date(2024, 3, 1, 10, 25)},
+		{"step from a start wraps the hour", "5/20 * * * *", date(2024, 3, 1, 10, 45), date(2024, 3, 1, 11, 5)},
+		{"step over a range", "0 8-18/5 * * *", date(2024, 3, 1, 13, 1), date(2024, 3, 1, 18, 0)},
+		{"working hours skip the weekend", "*/15 9-17 * * 1-5", date(2024, 3, 1, 17, 50), date(2024, 3, 4, 9, 0)},
+		{"day of week", "0 0 * * 3", date(2024, 3, 1, 0, 0), date(2024, 3, 6, 0, 0)},
+		{"7 is sunday", "0 0 * * 7", date(2024, 9, 2, 0, 0), date(2024, 9, 8, 0, 0)},
+		{"day of month in the next month", "30 2 1 * *", date(2024, 1, 31, 3, 0), date(2024, 2, 1, 2, 30)},
+		{"day of month skips short months", "0 0 31 * *", date(2024, 4, 15, 0, 0), date(2024, 5, 31, 0, 0)},
+		{"february 29th", "0 12 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 12, 0)},
+		{"month", "0 0 1 6 *", date(2024, 7, 1, 0, 0), date(2025, 6, 1, 0, 0)},
+		{"either day field matches", "0 0 13 * 5", date(2024, 9, 1, 0, 0), date(2024, 9, 6, 0, 0)},
+		{"either day field matches, day of month first", "0 0 2 * 5", date(2024, 9, 1, 0, 0), date(2024, 9, 2, 0, 0)},
+		{"a day of month step restricts the day", "0 0 */10 * 1", date(2024, 3, 1, 0, 0), date(2024, 3, 4, 0, 0)},
+		{"monthly across the year", "@monthly", date(2024, 12, 31, 23, 59), date(2025, 1, 1, 0, 0)},
+		{"yearly", "@yearly", date(2024, 1, 1, 0, 0), date(2025, 1, 1, 0, 0)},
+		{"weekly", "@weekly", date(2024, 3, 1, 0, 0), date(2024, 3, 3, 0, 0)},
+		{"daily", "@daily", date(2024, 2, 28, 12, 0), date(2024, 2, 29, 0, 0)},
+		{"hourly", "@hourly", date(2024, 3, 1, 10, 0), date(2024, 3, 1, 11, 0)},
+		{"never", "0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) failed: %v", test.spec, err)
+			}
+			if got := schedule.Next(test.from); !got.Equal(test.want) {
+				t.Errorf("Next(%v) of %q = %v, want %v", test.from, test.spec, got, test.want)
+			}
+		})
+	}
+}
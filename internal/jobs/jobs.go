@@ -0,0 +1,496 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/filter"
+	"github.com/siahsang/blog/internal/utils/databaseutils"
+	"github.com/siahsang/blog/internal/utils/retryutils"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	// StatusDead is a job that failed every attempt. It stays in the table until it is retried.
+	StatusDead = "dead"
+)
+
+const (
+	firstRetryDelay = 10 * time.Second
+	maxRetryDelay   = time.Hour
+	// scheduleInterval is how often the recurring jobs are enqueued ahead of their next run.
+	scheduleInterval = 30 * time.Second
+)
+
+var (
+	ErrJobNotFound     = xerrors.Message("job not found")
+	ErrJobNotRetryable = xerrors.Message("only dead jobs can be retried")
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Queue       string          `json:"queue"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LastError   *string         `json:"lastError"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	FinishedAt  *time.Time      `json:"finishedAt"`
+}
+
+type Handler func(ctx context.Context, job *Job) error
+
+// Queue runs its jobs with at most Concurrency at a time, each bounded by Timeout.
+type Queue struct {
+	Name        string
+	Concurrency int
+	Timeout     time.Duration
+}
+
+type kind struct {
+	queue       string
+	maxAttempts int
+	handler     Handler
+}
+
+type recurring struct {
+	kind     string
+	schedule *Schedule
+	payload  json.RawMessage
+}
+
+// Runner stores jobs in PostgreSQL and runs them with the handler registered for their kind. Jobs survive
+// restarts, are retried with backoff when their handler fails and are kept as dead once out of attempts.
+// Queues, kinds and recurring jobs must be registered before Run is called.
+type Runner struct {
+	sqlTemplate  *databaseutils.SQLTemplate
+	log          *slog.Logger
+	pollInterval time.Duration
+	queues       map[string]Queue
+	kinds        map[string]kind
+	recurring    []recurring
+}
+
+func NewRunner(sqlTemplate *databaseutils.SQLTemplate, log *slog.Logger, pollInterval time.Duration) *Runner {
+	return &Runner{
+		sqlTemplate:  sqlTemplate,
+		log:          log,
+		pollInterval: pollInterval,
+		queues:       make(map[string]Queue),
+		kinds:        make(map[string]kind),
+	}
+}
+
+func (r *Runner) AddQueue(queue Queue) {
+	r.queues[queue.Name] = queue
+}
+
+// Handle registers the handler of a job kind, run on the given queue and attempted up to maxAttempts times.
+func (r *Runner) Handle(kindName, queue string, maxAttempts int, handler Handler) {
+	if _, ok := r.queues[queue]; !ok {
+		panic(fmt.Sprintf("jobs: queue %q of kind %q is not registered", queue, kindName))
+	}
+	r.kinds[kindName] = kind{queue: queue, maxAttempts: maxAttempts, handler: handler}
+}
+
+// Register is Handle for handlers that take the payload decoded into T.
+func Register[T any](r *Runner, kindName, queue string, maxAttempts int, handler func(ctx context.Context, payload T) error) {
+	r.Handle(kindName, queue, maxAttempts, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return xerrors.New(err)
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// Schedule enqueues a job of the kind at every time matching the cron expression. Each run is enqueued
+// once, however many instances are running. Expressions that never match, such as february 30th, are
+// rejected.
+func (r *Runner) Schedule(spec, kindName string, payload any) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return xerrors.Newf("cron expression %q never matches", spec)
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return xerrors.New(err)
+	}
+	r.recurring = append(r.recurring, recurring{kind: kindName, schedule: schedule, payload: encoded})
+	return nil
+}
+
+type enqueueOptions struct {
+	runAt     time.Time
+	uniqueKey *string
+}
+
+type EnqueueOption func(*enqueueOptions)
+
+// RunAt delays the job until t.
+func RunAt(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) { o.runAt = t }
+}
+
+// UniqueKey makes Enqueue skip the job if one with the same key was already enqueued.
+func UniqueKey(key string) EnqueueOption {
+	return func(o *enqueueOptions) { o.uniqueKey = &key }
+}
+
+const jobColumns = `id, queue, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at, finished_at`
+
+// Enqueue stores a job of the kind. Called with a transaction in ctx, the job only exists if the
+// transaction commits. It returns nil when the job was skipped because of its unique key.
+func (r *Runner) Enqueue(ctx context.Context, kindName string, payload any, opts ...EnqueueOption) (*Job, error) {
+	k, ok := r.kinds[kindName]
+	if !ok {
+		return nil, xerrors.Newf("jobs: kind %q is not registered", kindName)
+	}
+
+	options := enqueueOptions{runAt: time.Now()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const insertSQL = `
+		INSERT INTO jobs (queue, kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+		RETURNING ` + jobColumns
+
+	job, err := databaseutils.ExecuteSingleQuery(r.sqlTemplate, ctx, insertSQL, scanJob,
+		k.queue, kindName, string(encoded), k.maxAttempts, options.runAt, options.uniqueKey)
+	if err != nil {
+		if errors.Is(err, databaseutils.ErrNoRowsFound) {
+			return nil, nil
+		}
+		return nil, xerrors.New(err)
+	}
+
+	return job, nil
+}
+
+// Run works the queues and enqueues the recurring jobs until ctx is cancelled, then waits for the
+// running jobs to finish. Running jobs are not cancelled with ctx, only bounded by their queue's timeout.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, queue := range r.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx, queue)
+		}()
+	}
+
+	r.schedule(ctx)
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context, queue Queue) {
+	var (
+		running sync.WaitGroup
+		slots   = make(chan struct{}, queue.Concurrency)
+		ticker  = time.NewTicker(r.pollInterval)
+	)
+	defer ticker.Stop()
+	defer running.Wait()
+
+	for {
+		if free := queue.Concurrency - len(slots); free > 0 {
+			claimed, err := r.claim(ctx, queue, free)
+			if err != nil {
+				r.log.Error("failed to claim jobs", "queue", queue.Name, "error", err.Error())
+			}
+
+			for _, job := range claimed {
+				slots <- struct{}{}
+				running.Add(1)
+				go func() {
+					defer running.Done()
+					defer func() { <-slots }()
+					r.execute(queue, job)
+				}()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim picks up to limit due jobs of the queue and leases them for the queue's timeout. A job whose lease
+// ran out belongs to a runner that died, so it is picked up again, or given up if it has no attempts left.
+func (r *Runner) claim(ctx context.Context, queue Queue, limit int) ([]*Job, error) {
+	const expireSQL = `
+		UPDATE jobs
+		SET status      = 'dead',
+		    last_error  = 'lease expired',
+		    finished_at = NOW(),
+		    updated_at  = NOW()
+		WHERE queue = $1 AND status = 'running' AND locked_until < NOW() AND attempts >= max_attempts
+	`
+	if _, err := databaseutils.ExecuteNonQuery(r.sqlTemplate, ctx, expireSQL, queue.Name); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	const claimSQL = `
+		WITH due AS (
+		    SELECT id
+		    FROM jobs
+		    WHERE queue = $1
+		      AND ((status = 'pending' AND run_at <= NOW()) OR (status = 'running' AND locked_until < NOW()))
+		    ORDER BY run_at, id
+		    LIMIT $2
+		    FOR UPDATE SKIP LOCKED
+		)
+		UPDATE jobs AS j
+		SET status       = 'running',
+		    attempts     = j.attempts + 1,
+		    locked_until = NOW() + make_interval(secs => $3),
+		    updated_at   = NOW()
+		FROM due
+		WHERE j.id = due.id
+		RETURNING j.id, j.queue, j.kind, j.payload, j.status, j.attempts, j.max_attempts, j.run_at, j.last_error,
+		    j.created_at, j.updated_at, j.finished_at
+	`
+
+	// the lease outlasts the timeout so a job isn't picked up again while it is still being stopped
+	lease := queue.Timeout + time.Minute
+	result, err := databaseutils.ExecuteQuery(r.sqlTemplate, ctx, claimSQL, scanJob, queue.Name, limit, lease.Seconds())
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+func (r *Runner) execute(queue Queue, job *Job) {
+	// a job runs to completion on shutdown, so it doesn't take the cancelled context of Run
+	ctx, cancel := context.WithTimeout(context.Background(), queue.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	jobErr := r.handle(ctx, job)
+	if jobErr == nil {
+		r.log.Info("job succeeded", "id", job.ID, "kind", job.Kind, "duration", time.Since(start))
+		if err := r.markSucceeded(context.Background(), job.ID); err != nil {
+			r.log.Error("failed to mark job succeeded", "id", job.ID, "error", err.Error())
+		}
+		return
+	}
+
+	dead := job.Attempts >= job.MaxAttempts
+	r.log.Error("job failed", "id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "dead", dead, "error", jobErr.Error())
+	if err := r.markFailed(context.Background(), job, jobErr, dead); err != nil {
+		r.log.Error("failed to mark job failed", "id", job.ID, "error", err.Error())
+	}
+}
+
+func (r *Runner) handle(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic in job handler: %v", rec)
+		}
+	}()
+
+	k, ok := r.kinds[job.Kind]
+	if !ok {
+		return xerrors.Newf("no handler for job kind %q", job.Kind)
+	}
+	return k.handler(ctx, job)
+}
+
+func (r *Runner) markSucceeded(ctx context.Context, jobId int64) error {
+	const updateSQL = `
+		UPDATE jobs
+		SET status       = 'succeeded',
+		    locked_until = NULL,
+		    last_error   = NULL,
+		    finished_at  = NOW(),
+		    updated_at   = NOW()
+		WHERE id = $1
+	`
+	if _, err := databaseutils.ExecuteNonQuery(r.sqlTemplate, ctx, updateSQL, jobId); err != nil {
+		return xerrors.New(err)
+	}
+	return nil
+}
+
+func (r *Runner) markFailed(ctx context.Context, job *Job, jobErr error, dead bool) error {
+	const retrySQL = `
+		UPDATE jobs
+		SET status       = 'pending',
+		    locked_until = NULL,
+		    last_error   = $2,
+		    run_at       = $3,
+		    updated_at   = NOW()
+		WHERE id = $1
+	`
+	const deadSQL = `
+		UPDATE jobs
+		SET status       = 'dead',
+		    locked_until = NULL,
+		    last_error   = $2,
+		    finished_at  = NOW(),
+		    updated_at   = NOW()
+		WHERE id = $1
+	`
+
+	var err error
+	if dead {
+		_, err = databaseutils.ExecuteNonQuery(r.sqlTemplate, ctx, deadSQL, job.ID, jobErr.Error())
+	} else {
+		_, err = databaseutils.ExecuteNonQuery(r.sqlTemplate, ctx, retrySQL, job.ID, jobErr.Error(), time.Now().Add(retryutils.Backoff(job.Attempts, firstRetryDelay, maxRetryDelay)))
+	}
+	if err != nil {
+		return xerrors.New(err)
+	}
+	return nil
+}
+
+// schedule enqueues the next run of every recurring job until ctx is cancelled. The run's time is part of
+// its unique key, so instances enqueuing the same run don't duplicate it.
+func (r *Runner) schedule(ctx context.Context) {
+	if len(r.recurring) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+		for _, job := range r.recurring {
+			next := job.schedule.Next(now)
+			if next.IsZero() {
+				continue
+			}
+			uniqueKey := fmt.Sprintf("cron:%s:%d", job.kind, next.Unix())
+			if _, err := r.Enqueue(ctx, job.kind, job.payload, RunAt(next), UniqueKey(uniqueKey)); err != nil {
+				r.log.Error("failed to schedule recurring job", "kind", job.kind, "error", err.Error())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Jobs lists the jobs with the given status, or every job when status is empty, most recently updated first.
+func (r *Runner) Jobs(ctx context.Context, status string, filter filter.Filter) ([]*Job, error) {
+	const selectSQL = `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE $1 = '' OR status = $1
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	result, err := databaseutils.ExecuteQuery(r.sqlTemplate, ctx, selectSQL, scanJob, status, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return result, nil
+}
+
+// Retry gives a dead job a new round of attempts, starting now.
+func (r *Runner) Retry(ctx context.Context, jobId int64) (*Job, error) {
+	const updateSQL = `
+		UPDATE jobs
+		SET status      = 'pending',
+		    attempts    = 0,
+		    run_at      = NOW(),
+		    finished_at = NULL,
+		    updated_at  = NOW()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING ` + jobColumns
+
+	job, err := databaseutils.ExecuteSingleQuery(r.sqlTemplate, ctx, updateSQL, scanJob, jobId)
+	if err == nil {
+		return job, nil
+	}
+	if !errors.Is(err, databaseutils.ErrNoRowsFound) {
+		return nil, xerrors.New(err)
+	}
+
+	// tell a missing job apart from one that isn't dead
+	const existsSQL = `SELECT id FROM jobs WHERE id = $1`
+	_, err = databaseutils.ExecuteSingleQuery(r.sqlTemplate, ctx, existsSQL, func(rows *sql.Rows) (int64, error) {
+		var id int64
+		return id, rows.Scan(&id)
+	}, jobId)
+	switch {
+	case errors.Is(err, databaseutils.ErrNoRowsFound):
+		return nil, xerrors.New(ErrJobNotFound)
+	case err != nil:
+		return nil, xerrors.New(err)
+	default:
+		return nil, xerrors.New(ErrJobNotRetryable)
+	}
+}
+
+// Prune deletes the jobs that succeeded more than retention ago and returns how many were deleted.
+func (r *Runner) Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	const deleteSQL = `
+		DELETE FROM jobs WHERE status = 'succeeded' AND finished_at < NOW() - make_interval(secs => $1)
+	`
+	deleted, err := databaseutils.ExecuteNonQuery(r.sqlTemplate, ctx, deleteSQL, retention.Seconds())
+	if err != nil {
+		return 0, xerrors.New(err)
+	}
+	return deleted, nil
+}
+
+func scanJob(rows *sql.Rows) (*Job, error) {
+	var (
+		job     = &Job{}
+		payload []byte
+	)
+	err := rows.Scan(
+		&job.ID,
+		&job.Queue,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	job.Payload = payload
+	return job, nil
+}
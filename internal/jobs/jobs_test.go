@@ -0,0 +1,17 @@
+package jobs
+
+import "testing"
+
+func TestScheduleRejectsNeverMatchingSpecs(t *testing.T) {
+	runner := &Runner{}
+
+	if err := runner.Schedule("0 0 30 2 *", "never", struct{}{}); err == nil {
+		t.Error("Schedule() of february 30th succeeded, want an error")
+	}
+	if err := runner.Schedule("0 12 29 2 *", "leap-day", struct{}{}); err != nil {
+		t.Errorf("Schedule() of february 29th failed: %v", err)
+	}
+	if len(runner.recurring) != 1 {
+		t.Errorf("%d recurring jobs, want 1", len(runner.recurring))
+	}
+}
@@ -0,0 +1,130 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Document is Markdown rendered to sanitized HTML.
+type Document struct {
+	HTML string    `json:"html"`
+	TOC  []Heading `json:"toc"`
+}
+
+// Heading is an entry of the table of contents. ID is the anchor of the heading in the HTML.
+type Heading struct {
+	Level int    `json:"level"`
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+}
+
+// Renderer turns Markdown into HTML that is safe to embed: whatever HTML the source contains is
+// checked against an allowlist, scripts and event handlers never make it through.
+type Renderer struct {
+	article goldmark.Markdown
+	comment goldmark.Markdown
+	policy  *bluemonday.Policy
+}
+
+func NewRenderer() *Renderer {
+	return &Renderer{
+		article: goldmark.New(
+			goldmark.WithExtensions(extension.GFM),
+			goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		),
+		// comments share the page with the article, their headings don't get anchors that could clash with it
+		comment: goldmark.New(goldmark.WithExtensions(extension.GFM)),
+		policy:  newPolicy(),
+	}
+}
+
+// newPolicy allows the formatting Markdown produces. Every link gets rel="nofollow", so links in
+// articles and comments don't pass reputation to spam.
+func newPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	// task lists of GitHub flavored Markdown
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	return policy
+}
+
+// RenderArticle renders an article body, with anchors on its headings and their table of contents.
+func (r *Renderer) RenderArticle(source string) (*Document, error) {
+	document := r.article.Parser().Parse(text.NewReader([]byte(source)))
+
+	var buffer bytes.Buffer
+	if err := r.article.Renderer().Render(&buffer, []byte(source), document); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	return &Document{
+		HTML: r.policy.Sanitize(buffer.String()),
+		TOC:  tableOfContents(document, []byte(source)),
+	}, nil
+}
+
+// RenderComment renders a comment body.
+func (r *Renderer) RenderComment(source string) (string, error) {
+	var buffer bytes.Buffer
+	if err := r.comment.Convert([]byte(source), &buffer); err != nil {
+		return "", xerrors.New(err)
+	}
+	return r.policy.Sanitize(buffer.String()), nil
+}
+
+func tableOfContents(document ast.Node, source []byte) []Heading {
+	toc := []Heading{}
+	_ = ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+		toc = append(toc, Heading{
+			Level: heading.Level,
+			ID:    string(idBytes),
+			Text:  plainText(heading, source),
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// plainText is the text of the node without its formatting, e.g. "Install *now*" is "Install now".
+func plainText(node ast.Node, source []byte) string {
+	var buffer bytes.Buffer
+	_ = ast.Walk(node, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch child := child.(type) {
+		case *ast.Text:
+			buffer.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				buffer.WriteByte(' ')
+			}
+		case *ast.String:
+			buffer.Write(child.Value)
+		case *ast.CodeSpan:
+			for grandchild := child.FirstChild(); grandchild != nil; grandchild = grandchild.NextSibling() {
+				if segment, ok := grandchild.(*ast.Text); ok {
+					buffer.Write(segment.Segment.Value(source))
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return buffer.String()
+}
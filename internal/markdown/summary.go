@@ -0,0 +1,82 @@
+package markdown
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	// wordsPerMinute is the reading speed the reading time is estimated with.
+	wordsPerMinute = 200
+	// excerptLength is how many characters of the body the excerpt holds at most.
+	excerptLength = 200
+)
+
+// Summary describes a Markdown body in numbers and a plain text preview.
+type Summary struct {
+	WordCount          int
+	ReadingTimeMinutes int
+	Excerpt            string
+}
+
+var summaryParser = goldmark.New(goldmark.WithExtensions(extension.GFM)).Parser()
+
+// Summarize counts the words of the text the Markdown renders to, estimates how long it takes to read
+// and cuts an excerpt from its paragraphs. Markup, link targets and images don't count as words.
+func Summarize(source string) Summary {
+	document := summaryParser.Parse(text.NewReader([]byte(source)))
+
+	var (
+		wordCount  int
+		paragraphs []string
+	)
+	_ = ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := node.(type) {
+		case *ast.Paragraph, *ast.TextBlock:
+			paragraph := plainText(node, []byte(source))
+			wordCount += len(strings.Fields(paragraph))
+			paragraphs = append(paragraphs, paragraph)
+			return ast.WalkSkipChildren, nil
+		case *ast.Heading:
+			wordCount += len(strings.Fields(plainText(node, []byte(source))))
+			return ast.WalkSkipChildren, nil
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			lines := node.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				wordCount += len(strings.Fields(string(segment.Value([]byte(source)))))
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	summary := Summary{WordCount: wordCount, Excerpt: excerpt(paragraphs)}
+	if wordCount > 0 {
+		summary.ReadingTimeMinutes = int(math.Ceil(float64(wordCount) / wordsPerMinute))
+	}
+	return summary
+}
+
+// excerpt joins the paragraphs up to excerptLength characters, cutting the last one at a word boundary.
+func excerpt(paragraphs []string) string {
+	joined := strings.Join(strings.Fields(strings.Join(paragraphs, " ")), " ")
+	if utf8.RuneCountInString(joined) <= excerptLength {
+		return joined
+	}
+
+	cut := string([]rune(joined)[:excerptLength])
+	if lastSpace := strings.LastIndexByte(cut, ' '); lastSpace > 0 {
+		cut = cut[:lastSpace]
+	}
+	return strings.TrimRight(cut, ",;:.-") + "…"
+}
@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// subscriptionBufferSize is how many messages a subscriber may fall behind before messages are dropped for it.
+const subscriptionBufferSize = 64
+
+// Message is delivered to every subscription of its topic.
+type Message struct {
+	Topic string          `json:"topic"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Broker relays messages between application instances. Messages published through a broker are
+// delivered back to every instance, including the publishing one, by the deliver function passed to Listen.
+type Broker interface {
+	Publish(ctx context.Context, message Message) error
+	Listen(ctx context.Context, deliver func(Message)) error
+}
+
+// Hub is an in-process publish/subscribe hub, optionally backed by a Broker to stay in sync with
+// other instances.
+type Hub struct {
+	mutex       sync.RWMutex
+	subscribers map[string]map[*Subscription]struct{}
+	closed      bool
+	broker      Broker
+	log         *slog.Logger
+}
+
+type Subscription struct {
+	C      <-chan Message
+	c      chan Message
+	topics []string
+	hub    *Hub
+	once   sync.Once
+}
+
+// NewHub creates a hub. broker may be nil, in which case messages only reach local subscribers.
+func NewHub(log *slog.Logger, broker Broker) *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[*Subscription]struct{}),
+		broker:      broker,
+		log:         log,
+	}
+}
+
+// Subscribe returns a subscription receiving the messages of all given topics. Its channel is closed
+// when the subscription or the hub is closed.
+func (hub *Hub) Subscribe(topics ...string) *Subscription {
+	c := make(chan Message, subscriptionBufferSize)
+	subscription := &Subscription{C: c, c: c, topics: topics, hub: hub}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		close(c)
+		return subscription
+	}
+
+	for _, topic := range topics {
+		if hub.subscribers[topic] == nil {
+			hub.subscribers[topic] = make(map[*Subscription]struct{})
+		}
+		hub.subscribers[topic][subscription] = struct{}{}
+	}
+
+	return subscription
+}
+
+func (subscription *Subscription) Close() {
+	subscription.once.Do(func() {
+		hub := subscription.hub
+		hub.mutex.Lock()
+		defer hub.mutex.Unlock()
+
+		for _, topic := range subscription.topics {
+			delete(hub.subscribers[topic], subscription)
+			if len(hub.subscribers[topic]) == 0 {
+				delete(hub.subscribers, topic)
+			}
+		}
+
+		if !hub.closed {
+			close(subscription.c)
+		}
+	})
+}
+
+// Publish sends the message to the subscribers of its topic, through the broker when there is one.
+func (hub *Hub) Publish(ctx context.Context, topic, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	message := Message{Topic: topic, Event: event, Data: payload}
+
+	if hub.broker != nil {
+		if err := hub.broker.Publish(ctx, message); err == nil {
+			return nil
+		} else {
+			// other instances miss the message, but local subscribers still get it
+			hub.log.Error("failed to publish message to broker", "topic", topic, "error", err.Error())
+		}
+	}
+
+	hub.deliver(message)
+	return nil
+}
+
+// Run listens to the broker until ctx is cancelled. It returns immediately when there is no broker.
+func (hub *Hub) Run(ctx context.Context) {
+	if hub.broker == nil {
+		return
+	}
+
+	if err := hub.broker.Listen(ctx, hub.deliver); err != nil {
+		hub.log.Error("pubsub broker stopped", "error", err.Error())
+	}
+}
+
+// Close closes every subscription, which ends the streams waiting on them.
+func (hub *Hub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		return
+	}
+	hub.closed = true
+
+	closedSubscriptions := map[*Subscription]struct{}{}
+	for _, subscriptions := range hub.subscribers {
+		for subscription := range subscriptions {
+			if _, ok := closedSubscriptions[subscription]; !ok {
+				close(subscription.c)
+				closedSubscriptions[subscription] = struct{}{}
+			}
+		}
+	}
+	hub.subscribers = make(map[string]map[*Subscription]struct{})
+}
+
+func (hub *Hub) deliver(message Message) {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	for subscription := range hub.subscribers[message.Topic] {
+		select {
+		case subscription.c <- message:
+		default:
+			hub.log.Warn("subscriber is too slow, message dropped", "topic", message.Topic)
+		}
+	}
+}
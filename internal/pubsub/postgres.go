@@ -0,0 +1,143 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mdobak/go-xerrors"
+)
+
+const (
+	// postgresChannel is the LISTEN/NOTIFY channel shared by every instance.
+	postgresChannel = "blog_pubsub"
+	// maxNotifyPayload stays below the 8000 bytes PostgreSQL allows for a NOTIFY payload.
+	maxNotifyPayload = 7900
+	// storedMessageRetention is how long a stored message is kept for the listeners to read it.
+	storedMessageRetention = time.Minute
+)
+
+// postgresNotification is the payload of a notification: either the message itself or, for a message
+// too large to be sent that way, the id of the pubsub_messages row holding it.
+type postgresNotification struct {
+	Message
+	StoredId int64 `json:"storedId,omitempty"`
+}
+
+// PostgresBroker relays hub messages between instances over PostgreSQL LISTEN/NOTIFY. Payloads are
+// limited to 8000 bytes by PostgreSQL, so larger messages are stored in a table and sent by id.
+type PostgresBroker struct {
+	db  *sql.DB
+	dsn string
+	log *slog.Logger
+}
+
+func NewPostgresBroker(db *sql.DB, dsn string, log *slog.Logger) *PostgresBroker {
+	return &PostgresBroker{db: db, dsn: dsn, log: log}
+}
+
+func (broker *PostgresBroker) Publish(ctx context.Context, message Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	if len(payload) > maxNotifyPayload {
+		if payload, err = broker.store(ctx, payload); err != nil {
+			return err
+		}
+	}
+
+	if _, err := broker.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", postgresChannel, string(payload)); err != nil {
+		return xerrors.New(err)
+	}
+
+	return nil
+}
+
+// store saves a message too large to notify and returns the notification referring to it. Messages older
+// than storedMessageRetention are removed on the way.
+func (broker *PostgresBroker) store(ctx context.Context, payload []byte) ([]byte, error) {
+	const deleteSQL = `DELETE FROM pubsub_messages WHERE created_at < NOW() - make_interval(secs => $1)`
+	if _, err := broker.db.ExecContext(ctx, deleteSQL, storedMessageRetention.Seconds()); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	var storedId int64
+	const insertSQL = `INSERT INTO pubsub_messages (payload) VALUES ($1) RETURNING id`
+	if err := broker.db.QueryRowContext(ctx, insertSQL, string(payload)).Scan(&storedId); err != nil {
+		return nil, xerrors.New(err)
+	}
+
+	notification, err := json.Marshal(postgresNotification{StoredId: storedId})
+	if err != nil {
+		return nil, xerrors.New(err)
+	}
+	return notification, nil
+}
+
+// load returns the message of a notification, reading a stored message from the table.
+func (broker *PostgresBroker) load(ctx context.Context, payload string) (Message, error) {
+	var notification postgresNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		return Message{}, xerrors.New(err)
+	}
+	if notification.StoredId == 0 {
+		return notification.Message, nil
+	}
+
+	const selectSQL = `SELECT payload FROM pubsub_messages WHERE id = $1`
+	if err := broker.db.QueryRowContext(ctx, selectSQL, notification.StoredId).Scan(&payload); err != nil {
+		return Message{}, xerrors.New(err)
+	}
+
+	var message Message
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		return Message{}, xerrors.New(err)
+	}
+	return message, nil
+}
+
+// Listen delivers every notification of the channel until ctx is cancelled. The listener reconnects
+// on its own; messages sent while it is disconnected are lost.
+func (broker *PostgresBroker) Listen(ctx context.Context, deliver func(Message)) error {
+	listener := pq.NewListener(broker.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			broker.log.Error("pubsub listener connection problem", "error", err.Error())
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(postgresChannel); err != nil {
+		return xerrors.New(err)
+	}
+
+	ticker := time.NewTicker(90 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.NotificationChannel():
+			// a nil notification means the connection was re-established
+			if notification == nil {
+				continue
+			}
+
+			message, err := broker.load(ctx, notification.Extra)
+			if err != nil {
+				broker.log.Error("invalid pubsub notification", "error", err.Error())
+				continue
+			}
+			deliver(message)
+		case <-ticker.C:
+			if err := listener.Ping(); err != nil {
+				broker.log.Error("pubsub listener ping failed", "error", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+)
+
+// Presence tracks who is connected to a topic. A member may hold several connections and stays
+// present until the last one leaves. Join and Leave only know about the connections of this instance;
+// every instance publishes its own members and Update combines what the instances reported.
+type Presence struct {
+	mutex    sync.Mutex
+	instance string
+	members  map[string]map[string]int
+	// reported holds the members each instance last reported for a topic, this one included.
+	reported map[string]map[string][]string
+}
+
+func NewPresence() *Presence {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return &Presence{
+		instance: hex.EncodeToString(id),
+		members:  make(map[string]map[string]int),
+		reported: make(map[string]map[string][]string),
+	}
+}
+
+// Instance identifies this instance in the members it reports.
+func (presence *Presence) Instance() string {
+	return presence.instance
+}
+
+// Join adds a connection of the member and returns the members of the topic on this instance.
+func (presence *Presence) Join(topic, member string) []string {
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+
+	if presence.members[topic] == nil {
+		presence.members[topic] = make(map[string]int)
+	}
+	presence.members[topic][member]++
+
+	return presence.list(topic)
+}
+
+// Leave removes a connection of the member and returns the members of the topic on this instance.
+func (presence *Presence) Leave(topic, member string) []string {
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+
+	if presence.members[topic][member] > 1 {
+		presence.members[topic][member]--
+	} else {
+		delete(presence.members[topic], member)
+	}
+
+	if len(presence.members[topic]) == 0 {
+		delete(presence.members, topic)
+	}
+
+	return presence.list(topic)
+}
+
+// Members returns the members of the topic on this instance.
+func (presence *Presence) Members(topic string) []string {
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+
+	return presence.list(topic)
+}
+
+// Update records the members an instance reported for the topic and returns the members of the topic
+// across all instances. isNew tells that the instance had no members recorded for the topic before, so
+// it doesn't know about the members of the other instances yet. The same report may be recorded several
+// times.
+func (presence *Presence) Update(topic, instance string, members []string) (all []string, isNew bool) {
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+
+	_, known := presence.reported[topic][instance]
+	switch {
+	case len(members) > 0:
+		if presence.reported[topic] == nil {
+			presence.reported[topic] = make(map[string][]string)
+		}
+		presence.reported[topic][instance] = members
+	default:
+		delete(presence.reported[topic], instance)
+		if len(presence.reported[topic]) == 0 {
+			delete(presence.reported, topic)
+		}
+	}
+
+	all = []string{}
+	for _, instanceMembers := range presence.reported[topic] {
+		all = append(all, instanceMembers...)
+	}
+	slices.Sort(all)
+
+	return slices.Compact(all), !known && len(members) > 0
+}
+
+func (presence *Presence) list(topic string) []string {
+	members := make([]string, 0, len(presence.members[topic]))
+	for member := range presence.members[topic] {
+		members = append(members, member)
+	}
+	slices.Sort(members)
+	return members
+}
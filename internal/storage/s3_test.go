@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "us-east-1"
+)
+
+// fakeS3 stands in for an S3 server. It keeps the objects in memory and refuses requests whose
+// Signature Version 4 doesn't match the one it computes itself.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	paths   []string
+	hosts   []string
+	status  int
+}
+
+type fakeObject struct {
+	contentType string
+	data        []byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	f.paths = append(f.paths, r.URL.EscapedPath())
+	f.hosts = append(f.hosts, r.Host)
+
+	if err := verifySignature(r, body); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if f.status != 0 {
+		http.Error(w, "<Error><Code>SlowDown</Code></Error>", f.status)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = fakeObject{contentType: r.Header.Get("Content-Type"), data: body}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		_, _ = w.Write(object.data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature recomputes the signature of the request the way S3 does and compares it with the
+// authorization header.
+func verifySignature(r *http.Request, body []byte) error {
+	payloadHash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(payloadHash[:]) {
+		return errors.New("payload hash doesn't match the body")
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date %q", amzDate)
+	}
+	if time.Since(signedAt).Abs() > 15*time.Minute {
+		return errors.New("request time is too skewed")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.Host,
+		"x-amz-content-sha256:" + r.Header.Get("X-Amz-Content-Sha256"),
+		"x-amz-date:" + amzDate,
+		"",
+		"host;x-amz-content-sha256;x-amz-date",
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := signedAt.Format("20060102") + "/" + testRegion + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), signedAt.Format("20060102"))
+	for _, part := range []string{testRegion, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	want := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		testAccessKey, scope, hex.EncodeToString(hmacSHA256(key, stringToSign)))
+	if got := r.Header.Get("Authorization"); got != want {
+		return fmt.Errorf("authorization %q, want %q", got, want)
+	}
+	return nil
+}
+
+func newTestS3(t *testing.T, pathStyle bool) (*S3Storage, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: map[string]fakeObject{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	// virtual-hosted addresses such as bucket.127.0.0.1 don't resolve, so every connection goes to the server
+	client := server.Client()
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	s3, err := NewS3Storage(S3Config{
+		Endpoint:  server.URL + "/",
+		Region:    testRegion,
+		Bucket:    "uploads",
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+		PathStyle: pathStyle,
+	}, client)
+	if err != nil {
+		t.Fatalf("NewS3Storage() failed: %v", err)
+	}
+	return s3, fake
+}
+
+func TestS3PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	s3, fake := newTestS3(t, true)
+	const key = "images/ab12/my photo+1.jpg"
+	data := []byte("jpeg bytes")
+
+	if err := s3.Put(ctx, key, "image/jpeg", data); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+
+	reader, contentType, err := s3.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(got, data) || contentType != "image/jpeg" {
+		t.Errorf("Get() = %q, %q, want %q, %q", got, contentType, data, "image/jpeg")
+	}
+
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, _, err := s3.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() = %v, want ErrNotFound", err)
+	}
+	// deleting a missing object isn't an error
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() of a missing object failed: %v", err)
+	}
+
+	const wantPath = "/uploads/images/ab12/my%20photo%2B1.jpg"
+	for i, path := range fake.paths {
+		if path != wantPath {
+			t.Errorf("request %d went to %q, want %q", i, path, wantPath)
+		}
+	}
+}
+
+func TestS3VirtualHostedStyle(t *testing.T) {
+	s3, fake := newTestS3(t, false)
+
+	if err := s3.Put(context.Background(), "avatars/a.png", "image/png", []byte("png")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if fake.paths[0] != "/avatars/a.png" {
+		t.Errorf("path = %q, want %q", fake.paths[0], "/avatars/a.png")
+	}
+	if !strings.HasPrefix(fake.hosts[0], "uploads.") {
+		t.Errorf("host = %q, want the bucket as a subdomain", fake.hosts[0])
+	}
+}
+
+func TestS3FailedRequests(t *testing.T) {
+	ctx := context.Background()
+	s3, fake := newTestS3(t, true)
+	fake.status = http.StatusServiceUnavailable
+
+	if err := s3.Put(ctx, "a/b", "text/plain", []byte("x")); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Put() = %v, want a 503 error", err)
+	}
+	if _, _, err := s3.Get(ctx, "a/b"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() = %v, want an error other than ErrNotFound", err)
+	}
+	if err := s3.Delete(ctx, "a/b"); err == nil {
+		t.Error("Delete() succeeded, want an error")
+	}
+}
+
+func TestS3WrongSecretIsRefused(t *testing.T) {
+	s3, _ := newTestS3(t, true)
+	s3.config.SecretKey = "wrong"
+
+	if err := s3.Put(context.Background(), "a/b", "text/plain", []byte("x")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put() = %v, want a 403 error", err)
+	}
+}
+
+func TestS3RejectsInvalidKeys(t *testing.T) {
+	s3, fake := newTestS3(t, true)
+
+	for _, key := range []string{"", "../secret", "/absolute", "a//b"} {
+		if err := s3.Put(context.Background(), key, "text/plain", nil); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if len(fake.paths) != 0 {
+		t.Errorf("%d requests reached the server", len(fake.paths))
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+var (
+	ErrNotFound   = xerrors.Message("object not found")
+	ErrInvalidKey = xerrors.Message("invalid object key")
+)
+
+// Storage keeps uploaded files. Keys are slash separated paths such as "images/ab12/original.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, contentType string, data []byte) error
+	// Get returns the content of the object and its content type. The caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidateKey rejects keys that could escape the storage root, e.g. "../secrets".
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return xerrors.New(ErrInvalidKey)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return xerrors.New(ErrInvalidKey)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tagging
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/siahsang/blog/internal/validator"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Name is a tag name in its canonical form, which tells tags apart, and the form it was typed in.
+type Name struct {
+	Canonical string
+	Display   string
+}
+
+// Rules bound the tags of an article.
+type Rules struct {
+	MaxTags   int
+	MaxLength int
+}
+
+var folder = cases.Fold()
+
+// Normalize returns the canonical form of a tag name: NFKC normalized and case folded, with runs of
+// whitespace and dashes collapsed into a single hyphen, so "Go", "go " and "GO" are one tag and so are
+// "machine learning" and "Machine-Learning". Invisible control and format characters are dropped.
+func Normalize(name string) string {
+	return collapse(folder.String(norm.NFKC.String(name)), '-')
+}
+
+// Display returns the name as it was typed, NFKC normalized with runs of whitespace and dashes
+// collapsed into a single space or hyphen.
+func Display(name string) string {
+	return collapse(norm.NFKC.String(name), 0)
+}
+
+// collapse drops invisible characters and replaces every run of separators by separator. A zero
+// separator keeps the first character of the run, a space if the run holds any whitespace.
+func collapse(name string, separator rune) string {
+	var (
+		builder strings.Builder
+		run     []rune
+	)
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if builder.Len() > 0 {
+			switch {
+			case separator != 0:
+				builder.WriteRune(separator)
+			case strings.ContainsFunc(string(run), unicode.IsSpace):
+				builder.WriteRune(' ')
+			default:
+				builder.WriteRune(run[0])
+			}
+		}
+		run = run[:0]
+	}
+
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r) || unicode.Is(unicode.Pd, r):
+			run = append(run, r)
+		case unicode.Is(unicode.Cc, r) || unicode.Is(unicode.Cf, r):
+			// e.g. zero width spaces, which would make identical looking tags differ
+		default:
+			flush()
+			builder.WriteRune(r)
+		}
+	}
+	// separators at the end are dropped like the ones at the start
+	return builder.String()
+}
+
+// ParseList normalizes the tags of an article, dropping the ones that repeat an earlier tag, and checks
+// them against the rules. The errors are added to v under "tagList".
+func ParseList(v *validator.Validator, names []string, rules Rules) []Name {
+	var (
+		parsed []Name
+		seen   = map[string]bool{}
+	)
+	for _, name := range names {
+		canonical := Normalize(name)
+		if canonical == "" {
+			v.AddError("tagList", "must not contain blank tags")
+			continue
+		}
+		if utf8.RuneCountInString(canonical) > rules.MaxLength {
+			v.AddError("tagList", fmt.Sprintf("tags must not be longer than %d characters: %q", rules.MaxLength, name))
+			continue
+		}
+		if seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+		parsed = append(parsed, Name{Canonical: canonical, Display: Display(name)})
+	}
+
+	v.Check(len(parsed) <= rules.MaxTags, "tagList", fmt.Sprintf("must not contain more than %d tags", rules.MaxTags))
+	return parsed
+}
@@ -1,35 +1,156 @@
 package collectionutils
 
-import "sync"
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
+// SafeMap is a map that is safe for concurrent use. It can optionally be bounded, in which case
+// the least recently used entry is evicted once the capacity is exceeded, and entries can
+// optionally expire after a fixed time to live.
 type SafeMap[K comparable, V any] struct {
-	data   map[K]V
-	mutext sync.RWMutex
+	data     map[K]*list.Element
+	order    *list.List // most recently used entries are kept at the front
+	capacity int
+	ttl      time.Duration
+	mutext   sync.Mutex
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+type safeMapEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// SafeMapStats is a snapshot of the map usage counters.
+type SafeMapStats struct {
+	Size      int    `json:"size"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
 }
 
 func (safeMap *SafeMap[K, V]) Store(newKey K, newValue V) {
 	safeMap.mutext.Lock()
 	defer safeMap.mutext.Unlock()
-	safeMap.data[newKey] = newValue
 
+	var expiresAt time.Time
+	if safeMap.ttl > 0 {
+		expiresAt = time.Now().Add(safeMap.ttl)
+	}
+
+	if element, exists := safeMap.data[newKey]; exists {
+		entry := element.Value.(*safeMapEntry[K, V])
+		entry.value = newValue
+		entry.expiresAt = expiresAt
+		safeMap.order.MoveToFront(element)
+		return
+	}
+
+	safeMap.data[newKey] = safeMap.order.PushFront(&safeMapEntry[K, V]{
+		key:       newKey,
+		value:     newValue,
+		expiresAt: expiresAt,
+	})
+
+	if safeMap.capacity > 0 && safeMap.order.Len() > safeMap.capacity {
+		safeMap.removeElement(safeMap.order.Back())
+		safeMap.evictions.Add(1)
+	}
 }
 
 func (safeMap *SafeMap[K, V]) Get(key K) (V, bool) {
-	safeMap.mutext.RLock()
-	defer safeMap.mutext.RUnlock()
-	value, exists := safeMap.data[key]
+	safeMap.mutext.Lock()
+	defer safeMap.mutext.Unlock()
+
+	element, exists := safeMap.data[key]
+	if !exists {
+		safeMap.misses.Add(1)
+		var zero V
+		return zero, false
+	}
 
-	return value, exists
+	entry := element.Value.(*safeMapEntry[K, V])
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		safeMap.removeElement(element)
+		safeMap.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+
+	safeMap.order.MoveToFront(element)
+	safeMap.hits.Add(1)
+	return entry.value, true
 }
 
 func (safeMap *SafeMap[K, V]) Delete(key K) {
 	safeMap.mutext.Lock()
 	defer safeMap.mutext.Unlock()
-	delete(safeMap.data, key)
+
+	if element, exists := safeMap.data[key]; exists {
+		safeMap.removeElement(element)
+	}
+}
+
+// DeleteExpired removes every expired entry. Expired entries are otherwise only dropped lazily
+// when they are read or pushed out by newer entries.
+func (safeMap *SafeMap[K, V]) DeleteExpired() {
+	safeMap.mutext.Lock()
+	defer safeMap.mutext.Unlock()
+
+	if safeMap.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for element := safeMap.order.Back(); element != nil; {
+		previous := element.Prev()
+		if now.After(element.Value.(*safeMapEntry[K, V]).expiresAt) {
+			safeMap.removeElement(element)
+		}
+		element = previous
+	}
 }
 
+func (safeMap *SafeMap[K, V]) Len() int {
+	safeMap.mutext.Lock()
+	defer safeMap.mutext.Unlock()
+	return safeMap.order.Len()
+}
+
+func (safeMap *SafeMap[K, V]) Stats() SafeMapStats {
+	return SafeMapStats{
+		Size:      safeMap.Len(),
+		Hits:      safeMap.hits.Load(),
+		Misses:    safeMap.misses.Load(),
+		Evictions: safeMap.evictions.Load(),
+	}
+}
+
+func (safeMap *SafeMap[K, V]) removeElement(element *list.Element) {
+	entry := safeMap.order.Remove(element).(*safeMapEntry[K, V])
+	delete(safeMap.data, entry.key)
+}
+
+// New returns an unbounded SafeMap whose entries never expire.
 func New[K comparable, V any]() *SafeMap[K, V] {
+	return NewBounded[K, V](0, 0)
+}
+
+// NewBounded returns a SafeMap that holds at most capacity entries, evicting the least recently
+// used one when full, and whose entries expire after ttl. A zero capacity or ttl disables the
+// corresponding limit.
+func NewBounded[K comparable, V any](capacity int, ttl time.Duration) *SafeMap[K, V] {
 	return &SafeMap[K, V]{
-		data: make(map[K]V),
+		data:     make(map[K]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+		ttl:      ttl,
 	}
 }
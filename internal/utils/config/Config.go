@@ -1,5 +1,101 @@
 package config
 
+import (
+	"time"
+
+	"github.com/siahsang/blog/internal/storage"
+)
+
 type Config struct {
-	JWTSecret string
+	JWTSecret   string
+	DatabaseDSN string
+	// SiteURL is the address of the web frontend, which feeds link articles and profiles to.
+	SiteURL string
+
+	// PubSubBackend is "memory" to deliver real-time updates within this instance only, or "postgres"
+	// to share them between instances over LISTEN/NOTIFY.
+	PubSubBackend string
+	// StreamHeartbeatInterval is how often an idle stream receives a comment to keep proxies from closing it.
+	StreamHeartbeatInterval time.Duration
+
+	// RenderedArticleCacheSize bounds the number of rendered article revisions kept in memory.
+	RenderedArticleCacheSize int
+	// RenderCommentMarkdown adds the comment body rendered from Markdown to comment responses.
+	RenderCommentMarkdown bool
+
+	// StorageBackend is "local" to keep uploads under UploadDir, or "s3" to keep them in the S3 bucket.
+	StorageBackend string
+	UploadDir      string
+	S3             storage.S3Config
+	// UploadsBaseURL is the public address uploaded files are served from, SiteURL + "/uploads" by default.
+	UploadsBaseURL string
+	// MaxImageUploadBytes bounds the size of an uploaded image file.
+	MaxImageUploadBytes int64
+	// MaxImagePixels bounds width times height of an uploaded image, which decoding allocates memory for.
+	MaxImagePixels int
+	// ThumbnailWidths are the widths uploaded images are scaled down to.
+	ThumbnailWidths []int
+	// AvatarWidth picks the thumbnail an uploaded profile image points at.
+	AvatarWidth int
+
+	// UserCacheSize bounds the number of authenticated users kept in memory.
+	UserCacheSize int
+	// UserCacheTTL is how long an authenticated user is served from memory before being reloaded.
+	UserCacheTTL time.Duration
+
+	// AccountDeletionGracePeriod is how long a deleted account stays hidden before it is purged.
+	AccountDeletionGracePeriod time.Duration
+	// AccountPurgeSchedule is the cron expression of the job that purges deleted accounts.
+	AccountPurgeSchedule string
+
+	// MaxTagsPerArticle and MaxTagLength bound the tag list of an article, the length in characters of
+	// the canonical name.
+	MaxTagsPerArticle int
+	MaxTagLength      int
+	// OrphanTagGracePeriod is how long a tag no article uses is kept before the cleanup job deletes it.
+	OrphanTagGracePeriod time.Duration
+
+	// TrendingSchedule is the cron expression of the job that recomputes the trending articles and tags.
+	TrendingSchedule string
+	// TrendingWindow is how far back engagement counts towards trending.
+	TrendingWindow time.Duration
+	// TrendingHalfLife is the age at which engagement counts half as much as fresh engagement.
+	TrendingHalfLife time.Duration
+
+	// Reactions are the emoji users can react to articles and comments with, in the order they are shown.
+	Reactions []string
+
+	// ViewDedupWindow is how long a viewer's repeated views of an article count as one.
+	ViewDedupWindow time.Duration
+	// ViewDedupSize bounds the number of recent views remembered for deduplication.
+	ViewDedupSize int
+	// ViewFlushInterval is how often the views counted in memory are added to the database.
+	ViewFlushInterval time.Duration
+
+	// RelatedArticlesCacheSize bounds the number of articles whose related articles are kept in memory.
+	RelatedArticlesCacheSize int
+	// RelatedArticlesCacheTTL is how long the related articles are served from memory, after which
+	// articles published in the meantime get a chance to be ranked.
+	RelatedArticlesCacheTTL time.Duration
+
+	// WebhookPollInterval is how often the dispatcher looks for webhook deliveries to send.
+	WebhookPollInterval time.Duration
+	// WebhookTimeout bounds a single delivery attempt.
+	WebhookTimeout time.Duration
+	// WebhookMaxAttempts is how many times a delivery is attempted before it is given up.
+	WebhookMaxAttempts int
+	// WebhookDisableAfterFailures is how many failed attempts in a row disable a webhook.
+	WebhookDisableAfterFailures int
+
+	// OutboxPollInterval is how often the relay looks for outbox events to dispatch.
+	OutboxPollInterval time.Duration
+	// OutboxMaxAttempts is how many times an event is dispatched before it is left in the outbox.
+	OutboxMaxAttempts int
+	// OutboxRetention is how long dispatched events are kept before they are pruned.
+	OutboxRetention time.Duration
+
+	// JobPollInterval is how often each job queue looks for due jobs.
+	JobPollInterval time.Duration
+	// JobRetention is how long succeeded jobs are kept before they are pruned. Dead jobs are kept until retried.
+	JobRetention time.Duration
 }
@@ -0,0 +1,16 @@
+package retryutils
+
+import "time"
+
+// Backoff returns how long to wait before the next attempt after the given number of failed attempts.
+// The delay starts at first and doubles with every failure, up to max.
+func Backoff(failedAttempts int, first, max time.Duration) time.Duration {
+	delay := first
+	for i := 1; i < failedAttempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
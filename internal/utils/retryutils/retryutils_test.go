@@ -0,0 +1,27 @@
+package retryutils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failedAttempts int
+		want           time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, test := range tests {
+		if got := Backoff(test.failedAttempts, 30*time.Second, 6*time.Hour); got != test.want {
+			t.Errorf("Backoff(%d) = %v, want %v", test.failedAttempts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+var ErrForbiddenAddress = xerrors.Message("webhook URL must not point to a local, private or reserved address")
+
+// reservedPrefixes are the ranges the netip predicates don't cover: "this network", carrier-grade NAT
+// (which some clouds use for their metadata service), IETF protocol assignments, benchmarking and the
+// reserved class E.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsForbiddenAddress reports whether deliveries to the address could reach the server itself or its
+// internal network: loopback, private, link-local (cloud metadata services included), multicast and
+// reserved addresses.
+func IsForbiddenAddress(address netip.Addr) bool {
+	address = address.Unmap()
+	if !address.IsValid() || address.IsUnspecified() || address.IsLoopback() || address.IsPrivate() ||
+		address.IsLinkLocalUnicast() || address.IsLinkLocalMulticast() || address.IsInterfaceLocalMulticast() ||
+		address.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL resolves the host of the webhook URL and returns ErrForbiddenAddress when any of its addresses
+// is forbidden. It is a courtesy to tell users early; the client of NewClient checks again on every
+// connection, since the host may resolve differently by then.
+func CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	addresses, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return xerrors.New(err)
+	}
+
+	for _, address := range addresses {
+		if IsForbiddenAddress(address) {
+			return xerrors.New(ErrForbiddenAddress)
+		}
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with in production. Its dialer refuses forbidden
+// addresses after the host is resolved, so neither redirects nor DNS rebinding can reach them.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return xerrors.New(err)
+			}
+			if IsForbiddenAddress(addrPort.Addr()) {
+				return xerrors.New(ErrForbiddenAddress)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would make the dialer check the proxy instead of the receiver
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
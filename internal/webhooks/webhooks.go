@@ -0,0 +1,132 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"github.com/siahsang/blog/internal/utils/retryutils"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Blog-Event"
+	DeliveryHeader  = "X-Blog-Delivery"
+	TimestampHeader = "X-Blog-Timestamp"
+	SignatureHeader = "X-Blog-Signature"
+)
+
+const (
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 6 * time.Hour
+	// maxDrainedBodySize is how much of the receiver's response is read, so the connection can be
+	// reused. The response itself is never kept: users could read internal services through the log.
+	maxDrainedBodySize = 4096
+)
+
+// Delivery is a signed POST of the payload to the webhook url.
+type Delivery struct {
+	ID      int64
+	Event   string
+	URL     string
+	Secret  string
+	Payload []byte
+}
+
+// Result is the outcome of a delivery attempt. Err is set for network errors and non-2xx responses.
+type Result struct {
+	StatusCode int
+	Err        error
+}
+
+// Sender posts deliveries with the given client, so tests can point it at an httptest server. Outside of
+// tests the client should come from NewClient.
+type Sender struct {
+	client *http.Client
+}
+
+func NewSender(client *http.Client) *Sender {
+	return &Sender{client: client}
+}
+
+func (sender *Sender) Send(ctx context.Context, delivery Delivery) Result {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return Result{Err: xerrors.New(err)}
+	}
+
+	timestamp := time.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "blog-webhooks/1.0")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	response, err := sender.client.Do(request)
+	if err != nil {
+		return Result{Err: xerrors.New(err)}
+	}
+	defer response.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxDrainedBodySize))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return Result{StatusCode: response.StatusCode, Err: xerrors.Newf("receiver responded with status %d", response.StatusCode)}
+	}
+
+	return Result{StatusCode: response.StatusCode}
+}
+
+// Sign returns the signature header value of the payload: the hex HMAC-SHA256 of "<unix timestamp>.<payload>".
+// Including the timestamp lets receivers reject replayed requests.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign, in constant time.
+func Verify(secret string, timestamp time.Time, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
+
+// Policy decides how failed deliveries are retried and when a failing webhook is disabled.
+type Policy struct {
+	// MaxAttempts is how many times a delivery is attempted before it is given up.
+	MaxAttempts int
+	// DisableAfter is how many failed attempts in a row disable a webhook.
+	DisableAfter int
+}
+
+// RetryAt returns when to attempt the delivery again after the given number of failed attempts, or nil
+// when the delivery is given up.
+func (policy Policy) RetryAt(now time.Time, failedAttempts int) *time.Time {
+	if failedAttempts >= policy.MaxAttempts {
+		return nil
+	}
+	retryAt := now.Add(retryutils.Backoff(failedAttempts, firstRetryDelay, maxRetryDelay))
+	return &retryAt
+}
+
+// Disables reports whether a webhook is disabled after the given number of failed attempts in a row.
+func (policy Policy) Disables(consecutiveFailures int) bool {
+	return consecutiveFailures >= policy.DisableAfter
+}
+
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", xerrors.New(err)
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,172 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendSignsDelivery(t *testing.T) {
+	const secret = "s3cret"
+	payload := []byte(`{"event":"article.created"}`)
+
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		receivedBody <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender := NewSender(server.Client())
+	result := sender.Send(context.Background(), Delivery{ID: 42, Event: "article.created", URL: server.URL, Secret: secret, Payload: payload})
+	if result.Err != nil || result.StatusCode != http.StatusNoContent {
+		t.Fatalf("Send() = %d, %v, want %d, nil", result.StatusCode, result.Err, http.StatusNoContent)
+	}
+
+	request, body := <-received, <-receivedBody
+	if got := request.Header.Get(EventHeader); got != "article.created" {
+		t.Errorf("%s = %q, want %q", EventHeader, got, "article.created")
+	}
+	if got := request.Header.Get(DeliveryHeader); got != "42" {
+		t.Errorf("%s = %q, want %q", DeliveryHeader, got, "42")
+	}
+
+	unix, err := strconv.ParseInt(request.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("%s is not a unix timestamp: %v", TimestampHeader, err)
+	}
+	timestamp := time.Unix(unix, 0)
+	signature := request.Header.Get(SignatureHeader)
+	if !Verify(secret, timestamp, body, signature) {
+		t.Errorf("signature %q doesn't verify the received payload", signature)
+	}
+	if Verify("other", timestamp, body, signature) {
+		t.Error("signature verifies with another secret")
+	}
+	if Verify(secret, timestamp.Add(time.Second), body, signature) {
+		t.Error("signature verifies with another timestamp")
+	}
+}
+
+func TestSendFailureLeavesOutResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("internal details"))
+	}))
+	defer server.Close()
+
+	result := NewSender(server.Client()).Send(context.Background(), Delivery{ID: 1, URL: server.URL, Payload: []byte("{}")})
+	if result.StatusCode != http.StatusInternalServerError {
+		t.Errorf("StatusCode = %d, want %d", result.StatusCode, http.StatusInternalServerError)
+	}
+	if result.Err == nil {
+		t.Fatal("Err = nil, want an error for a 500 response")
+	}
+	if strings.Contains(result.Err.Error(), "internal details") {
+		t.Errorf("Err = %q, must not contain the response body", result.Err.Error())
+	}
+}
+
+// TestPolicyRetriesAndDisables plays the dispatcher against a receiver that is down: every delivery is
+// retried with a growing delay until it is given up, and the webhook is disabled once enough attempts
+// in a row have failed.
+func TestPolicyRetriesAndDisables(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sender := NewSender(server.Client())
+	policy := Policy{MaxAttempts: 4, DisableAfter: 6}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	wantDelays := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute}
+	consecutiveFailures := 0
+	disabled := false
+	for deliveryId := int64(1); deliveryId <= 3 && !disabled; deliveryId++ {
+		for attempts := 1; !disabled; attempts++ {
+			result := sender.Send(context.Background(), Delivery{ID: deliveryId, URL: server.URL, Payload: []byte("{}")})
+			if result.Err == nil || result.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("Send() = %d, %v, want a 503 failure", result.StatusCode, result.Err)
+			}
+
+			consecutiveFailures++
+			disabled = policy.Disables(consecutiveFailures)
+
+			retryAt := policy.RetryAt(now, attempts)
+			if attempts == policy.MaxAttempts {
+				if retryAt != nil {
+					t.Fatalf("RetryAt after %d attempts = %v, want the delivery given up", attempts, retryAt)
+				}
+				break
+			}
+			if retryAt == nil || retryAt.Sub(now) != wantDelays[attempts-1] {
+				t.Fatalf("RetryAt after %d attempts = %v, want %v later", attempts, retryAt, wantDelays[attempts-1])
+			}
+		}
+	}
+
+	if !disabled {
+		t.Fatal("webhook wasn't disabled")
+	}
+	if got := requests.Load(); got != int32(policy.DisableAfter) {
+		t.Errorf("receiver got %d requests, want %d", got, policy.DisableAfter)
+	}
+}
+
+func TestNewClientRefusesLocalAddresses(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	result := NewSender(NewClient(time.Second)).Send(context.Background(), Delivery{ID: 1, URL: server.URL, Payload: []byte("{}")})
+	if !errors.Is(result.Err, ErrForbiddenAddress) {
+		t.Errorf("Err = %v, want ErrForbiddenAddress", result.Err)
+	}
+	if requests.Load() != 0 {
+		t.Error("the loopback receiver was reached")
+	}
+}
+
+func TestIsForbiddenAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.100.100.200", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fd00:ec2::254", true},
+		{"::ffff:127.0.0.1", true},
+		{"224.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+	}
+	for _, test := range tests {
+		if got := IsForbiddenAddress(netip.MustParseAddr(test.address)); got != test.want {
+			t.Errorf("IsForbiddenAddress(%s) = %v, want %v", test.address, got, test.want)
+		}
+	}
+}
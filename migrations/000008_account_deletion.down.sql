@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS users_purge_after_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS purge_after,
+    DROP COLUMN IF EXISTS article_policy,
+    DROP COLUMN IF EXISTS anonymized;
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at     TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS purge_after    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS article_policy TEXT,
+    ADD COLUMN IF NOT EXISTS anonymized     BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS users_purge_after_idx ON users (purge_after) WHERE deleted_at IS NOT NULL;
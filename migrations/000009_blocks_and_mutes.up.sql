@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_blocks
+(
+    blocker_id INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    blocked_id INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_mutes
+(
+    muter_id   INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    muted_id   INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (muter_id, muted_id)
+);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type          TEXT        NOT NULL,
+    article_id    INTEGER REFERENCES articles (id) ON DELETE CASCADE,
+    last_actor_id INTEGER     REFERENCES users (id) ON DELETE SET NULL,
+    actor_count   INTEGER     NOT NULL DEFAULT 1,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at       TIMESTAMPTZ
+);
+
+-- at most one unread notification per recipient, type and article; new events are aggregated into it
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_unread_aggregate_idx
+    ON notifications (user_id, type, (COALESCE(article_id, 0)))
+    WHERE read_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_updated_at_idx ON notifications (user_id, updated_at DESC);
+
+CREATE TABLE IF NOT EXISTS notification_actors
+(
+    notification_id BIGINT  NOT NULL REFERENCES notifications (id) ON DELETE CASCADE,
+    actor_id        INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    PRIMARY KEY (notification_id, actor_id)
+);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id              BIGSERIAL PRIMARY KEY,
+    -- identifies the event for consumers, which use it to process each event once
+    idempotency_key UUID        NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    event_type      TEXT        NOT NULL,
+    payload         JSONB       NOT NULL,
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    available_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dispatched_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (available_at, id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS processed_events
+(
+    consumer        TEXT        NOT NULL,
+    idempotency_key UUID        NOT NULL,
+    processed_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (consumer, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS processed_events_processed_at_idx ON processed_events (processed_at);
@@ -0,0 +1,2 @@
+-- the secret part of the url of the user's private feed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS feed_token TEXT UNIQUE;
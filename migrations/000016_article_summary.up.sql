@@ -0,0 +1,11 @@
+ALTER TABLE articles
+    ADD COLUMN IF NOT EXISTS word_count           INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reading_time_minutes INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS excerpt              TEXT    NOT NULL DEFAULT '';
+
+-- approximates the values of existing articles from their raw Markdown, saving an article computes them exactly
+UPDATE articles
+SET word_count           = COALESCE(array_length(regexp_split_to_array(btrim(body), '\s+'), 1), 0),
+    reading_time_minutes = CEIL(COALESCE(array_length(regexp_split_to_array(btrim(body), '\s+'), 1), 0) / 200.0),
+    excerpt              = LEFT(btrim(regexp_replace(regexp_replace(body, '[#*_`>\[\]]+', ' ', 'g'), '\s+', ' ', 'g')), 200)
+WHERE btrim(body) <> '';
@@ -0,0 +1,3 @@
+ALTER TABLE articles DROP COLUMN IF EXISTS cover_image;
+
+DROP TABLE IF EXISTS uploads;
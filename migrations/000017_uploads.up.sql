@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS uploads
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- storage key of the original, the thumbnails are stored next to it
+    key          TEXT        NOT NULL UNIQUE,
+    content_type TEXT        NOT NULL,
+    size         BIGINT      NOT NULL,
+    width        INTEGER     NOT NULL,
+    height       INTEGER     NOT NULL,
+    variants     JSONB       NOT NULL DEFAULT '[]',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS uploads_user_id_idx ON uploads (user_id, created_at DESC);
+
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS cover_image TEXT;
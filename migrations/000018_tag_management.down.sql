@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS articles_tags_tag_id_idx;
+DROP TABLE IF EXISTS tag_aliases;
+
+ALTER TABLE tags
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,15 @@
+ALTER TABLE tags
+    ADD COLUMN IF NOT EXISTS description  TEXT        NOT NULL DEFAULT '',
+    -- touched whenever an article is tagged, so the orphan cleanup spares tags that are being attached
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- alternative names of a tag, e.g. "golang" for "go". Tagging an article with an alias tags it with the tag.
+CREATE TABLE IF NOT EXISTS tag_aliases
+(
+    alias      TEXT PRIMARY KEY,
+    tag_id     INTEGER     NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS tag_aliases_tag_id_idx ON tag_aliases (tag_id);
+CREATE INDEX IF NOT EXISTS articles_tags_tag_id_idx ON articles_tags (tag_id);
@@ -0,0 +1,3 @@
+-- merged tags can't be split again, the display names become the names
+UPDATE tags SET name = display_name;
+ALTER TABLE tags DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,41 @@
+-- the name of a tag becomes its canonical form, the name as first typed is kept for display
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS display_name TEXT;
+UPDATE tags SET display_name = name WHERE display_name IS NULL;
+ALTER TABLE tags ALTER COLUMN display_name SET NOT NULL;
+
+-- approximates the normalization of the application: NFKC, lower case, whitespace and dashes collapsed
+CREATE FUNCTION pg_temp.canonical_tag_name(name TEXT) RETURNS TEXT AS
+$$
+SELECT btrim(regexp_replace(lower(normalize(name, NFKC)), '[[:space:]–—-]+', '-', 'g'), '-')
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- tags that only differ in spelling are merged into the oldest of them
+CREATE TEMPORARY TABLE tag_merges ON COMMIT DROP AS
+SELECT id, canonical, MIN(id) OVER (PARTITION BY canonical) AS keeper_id
+FROM (SELECT id, pg_temp.canonical_tag_name(name) AS canonical FROM tags) AS t;
+
+INSERT INTO articles_tags (article_id, tag_id)
+SELECT at.article_id, m.keeper_id
+FROM articles_tags AS at
+    JOIN tag_merges AS m ON m.id = at.tag_id
+WHERE m.id <> m.keeper_id
+ON CONFLICT DO NOTHING;
+
+UPDATE tag_aliases AS ta
+SET tag_id = m.keeper_id
+FROM tag_merges AS m
+WHERE m.id = ta.tag_id AND m.id <> m.keeper_id;
+
+DELETE FROM tags AS t USING tag_merges AS m WHERE m.id = t.id AND m.id <> m.keeper_id;
+
+UPDATE tags AS t SET name = m.canonical FROM tag_merges AS m WHERE m.id = t.id;
+
+-- aliases are canonical as well, the ones that now repeat a tag or another alias are dropped
+DELETE FROM tag_aliases AS ta
+WHERE EXISTS (SELECT 1 FROM tags AS t WHERE t.name = pg_temp.canonical_tag_name(ta.alias))
+   OR EXISTS (SELECT 1
+              FROM tag_aliases AS other
+              WHERE pg_temp.canonical_tag_name(other.alias) = pg_temp.canonical_tag_name(ta.alias)
+                AND other.alias < ta.alias);
+
+UPDATE tag_aliases SET alias = pg_temp.canonical_tag_name(alias);
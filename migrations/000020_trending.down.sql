@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS trending_tags;
+DROP TABLE IF EXISTS trending_articles;
+
+DROP INDEX IF EXISTS comments_created_at_idx;
+DROP INDEX IF EXISTS favourite_articles_created_at_idx;
+ALTER TABLE favourite_articles DROP COLUMN IF EXISTS created_at;
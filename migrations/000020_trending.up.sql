@@ -0,0 +1,29 @@
+-- favorites made before this migration count as old as their article
+ALTER TABLE favourite_articles ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+UPDATE favourite_articles AS fa SET created_at = a.created_at FROM articles AS a WHERE a.id = fa.article_id AND fa.created_at IS NULL;
+ALTER TABLE favourite_articles
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS favourite_articles_created_at_idx ON favourite_articles (created_at);
+CREATE INDEX IF NOT EXISTS comments_created_at_idx ON comments (created_at);
+
+-- rebuilt by the trending refresh job, ranked by time-decayed engagement
+CREATE TABLE IF NOT EXISTS trending_articles
+(
+    article_id  INTEGER          PRIMARY KEY REFERENCES articles (id) ON DELETE CASCADE,
+    score       DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMPTZ      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS trending_articles_score_idx ON trending_articles (score DESC);
+
+CREATE TABLE IF NOT EXISTS trending_tags
+(
+    tag_id         INTEGER          PRIMARY KEY REFERENCES tags (id) ON DELETE CASCADE,
+    score          DOUBLE PRECISION NOT NULL,
+    articles_count INTEGER          NOT NULL,
+    computed_at    TIMESTAMPTZ      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS trending_tags_score_idx ON trending_tags (score DESC);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS tag_follows
+(
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    tag_id     INTEGER     NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS tag_follows_tag_id_idx ON tag_follows (tag_id);
@@ -0,0 +1,10 @@
+-- title terms weigh most, then the description, then the body; related articles are matched on it
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', description), 'B') ||
+        setweight(to_tsvector('english', body), 'D')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS articles_search_vector_idx ON articles USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS articles_author_id_idx ON articles (author_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS followers_user_id_created_at_idx;
+ALTER TABLE followers DROP COLUMN IF EXISTS created_at;
+
+DROP TABLE IF EXISTS article_referrers;
+DROP TABLE IF EXISTS article_daily_views;
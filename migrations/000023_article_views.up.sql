@@ -0,0 +1,26 @@
+-- views are counted in memory and added to these in batches
+CREATE TABLE IF NOT EXISTS article_daily_views
+(
+    article_id INTEGER NOT NULL REFERENCES articles (id) ON DELETE CASCADE,
+    day        DATE    NOT NULL,
+    views      BIGINT  NOT NULL,
+    PRIMARY KEY (article_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS article_daily_views_day_idx ON article_daily_views (day);
+
+-- only views with a referrer are kept here, the remainder of article_daily_views came directly
+CREATE TABLE IF NOT EXISTS article_referrers
+(
+    article_id INTEGER NOT NULL REFERENCES articles (id) ON DELETE CASCADE,
+    day        DATE    NOT NULL,
+    referrer   TEXT    NOT NULL,
+    views      BIGINT  NOT NULL,
+    PRIMARY KEY (article_id, day, referrer)
+);
+
+-- follows made before this migration have no date and count as older than any range
+ALTER TABLE followers ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+ALTER TABLE followers ALTER COLUMN created_at SET DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS followers_user_id_created_at_idx ON followers (user_id, created_at);
@@ -0,0 +1,11 @@
+-- a private reading list, unlike favorites it is never shown to anyone but its owner
+CREATE TABLE IF NOT EXISTS bookmarks
+(
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    article_id INTEGER     NOT NULL REFERENCES articles (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, article_id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_user_id_created_at_idx ON bookmarks (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS bookmarks_article_id_idx ON bookmarks (article_id);
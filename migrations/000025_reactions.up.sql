@@ -0,0 +1,22 @@
+-- the reaction is stored as given; which reactions are accepted is configured in the application
+CREATE TABLE IF NOT EXISTS article_reactions
+(
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    article_id INTEGER     NOT NULL REFERENCES articles (id) ON DELETE CASCADE,
+    reaction   TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, article_id, reaction)
+);
+
+CREATE INDEX IF NOT EXISTS article_reactions_article_id_idx ON article_reactions (article_id);
+
+CREATE TABLE IF NOT EXISTS comment_reactions
+(
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    comment_id INTEGER     NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    reaction   TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, comment_id, reaction)
+);
+
+CREATE INDEX IF NOT EXISTS comment_reactions_comment_id_idx ON comment_reactions (comment_id);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS series
+(
+    id          SERIAL PRIMARY KEY,
+    slug        TEXT        NOT NULL UNIQUE,
+    title       TEXT        NOT NULL,
+    description TEXT        NOT NULL DEFAULT '',
+    author_id   INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS series_author_id_idx ON series (author_id);
+
+-- an article is part of one series at most; positions run from 1 without gaps and are checked at commit,
+-- so they can be shifted by a single update
+CREATE TABLE IF NOT EXISTS series_articles
+(
+    series_id  INTEGER NOT NULL REFERENCES series (id) ON DELETE CASCADE,
+    article_id INTEGER NOT NULL UNIQUE REFERENCES articles (id) ON DELETE CASCADE,
+    position   INTEGER NOT NULL CHECK (position > 0),
+    PRIMARY KEY (series_id, article_id),
+    CONSTRAINT series_articles_position_key UNIQUE (series_id, position) DEFERRABLE INITIALLY DEFERRED
+);
@@ -0,0 +1,12 @@
+-- co-authors of an article besides its author in articles.author_id; an invitation is pending until it is
+-- accepted
+CREATE TABLE IF NOT EXISTS article_authors
+(
+    article_id  INTEGER     NOT NULL REFERENCES articles (id) ON DELETE CASCADE,
+    user_id     INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMPTZ,
+    PRIMARY KEY (article_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS article_authors_user_id_idx ON article_authors (user_id);
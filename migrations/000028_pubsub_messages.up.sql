@@ -0,0 +1,10 @@
+-- hub messages too large for a NOTIFY payload; the notification only carries the id and the rows are
+-- removed after a short while
+CREATE TABLE IF NOT EXISTS pubsub_messages
+(
+    id         BIGSERIAL PRIMARY KEY,
+    payload    TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS pubsub_messages_created_at_idx ON pubsub_messages (created_at);
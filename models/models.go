@@ -1,13 +1,23 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Profile struct {
-	ID        int64   `json:"-"`
-	Username  string  `json:"username"`
-	Bio       *string `json:"bio"`
-	Image     *string `json:"image"`
-	Following bool    `json:"following"`
+	ID             int64   `json:"-"`
+	Username       string  `json:"username"`
+	Bio            *string `json:"bio"`
+	Image          *string `json:"image"`
+	Following      bool    `json:"following"`
+	FollowersCount int64   `json:"followersCount"`
+	FollowingCount int64   `json:"followingCount"`
+	Private        bool    `json:"private"`
+	// FollowRequested is set while the viewer waits for a private profile to approve the follow request.
+	FollowRequested bool `json:"followRequested,omitempty"`
+	Blocking        bool `json:"blocking,omitempty"`
+	Muting          bool `json:"muting,omitempty"`
 }
 
 type Article struct {
@@ -19,11 +29,80 @@ type Article struct {
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 	AuthorID    int64     `json:"-"`
+	// WordCount, ReadingTimeMinutes and Excerpt are derived from Body whenever it is saved.
+	WordCount          int     `json:"wordCount"`
+	ReadingTimeMinutes int     `json:"readingTimeMinutes"`
+	Excerpt            string  `json:"excerpt"`
+	CoverImage         *string `json:"coverImage"`
+}
+
+// Upload is an image stored by a user, together with the thumbnails generated from it.
+type Upload struct {
+	ID          int64           `json:"-"`
+	UserID      int64           `json:"-"`
+	Key         string          `json:"key"`
+	ContentType string          `json:"contentType"`
+	Size        int64           `json:"size"`
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	Variants    []UploadVariant `json:"variants"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+type UploadVariant struct {
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
 }
 
 type Tag struct {
-	ID   int64  `json:"-"`
-	Name string `json:"name"`
+	ID int64 `json:"-"`
+	// Name is the canonical form of the name, which tells tags apart. DisplayName is how it was first typed.
+	Name          string   `json:"name"`
+	DisplayName   string   `json:"displayName"`
+	Description   string   `json:"description"`
+	ArticlesCount int64    `json:"articlesCount"`
+	Aliases       []string `json:"aliases,omitempty"`
+}
+
+// FeedReason tells why an article is in the personal feed of a user.
+type FeedReason struct {
+	FollowedAuthor bool     `json:"followedAuthor"`
+	FollowedTags   []string `json:"followedTags"`
+}
+
+// ReactionCount is how many users reacted to an article or comment with a reaction, and whether the
+// viewer is one of them.
+type ReactionCount struct {
+	Reaction string `json:"reaction"`
+	Count    int64  `json:"count"`
+	Reacted  bool   `json:"reacted"`
+}
+
+type Series struct {
+	ID            int64
+	Slug          string
+	Title         string
+	Description   string
+	AuthorID      int64
+	ArticlesCount int64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SeriesPart places an article in its series: part Part of Total, between the Previous and Next parts.
+type SeriesPart struct {
+	Slug     string             `json:"slug"`
+	Title    string             `json:"title"`
+	Part     int                `json:"part"`
+	Total    int                `json:"total"`
+	Previous *SeriesArticleLink `json:"previous"`
+	Next     *SeriesArticleLink `json:"next"`
+}
+
+type SeriesArticleLink struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
 }
 
 type Comment struct {
@@ -34,3 +113,144 @@ type Comment struct {
 	AuthorID  int64
 	ArticleID int64
 }
+
+type UserDataExport struct {
+	ExportedAt time.Time          `json:"exportedAt"`
+	Profile    ExportedProfile    `json:"profile"`
+	Articles   []ExportedArticle  `json:"articles"`
+	Comments   []ExportedComment  `json:"comments"`
+	Favorites  []ExportedFavorite `json:"favorites"`
+	Bookmarks  []ExportedBookmark `json:"bookmarks"`
+	Following  []string           `json:"following"`
+	Followers  []string           `json:"followers"`
+}
+
+type ExportedProfile struct {
+	Username string  `json:"username"`
+	Email    string  `json:"email"`
+	Bio      *string `json:"bio"`
+	Image    *string `json:"image"`
+}
+
+type ExportedArticle struct {
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Body        string    `json:"body"`
+	TagList     []string  `json:"tagList"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ExportedComment struct {
+	ID          int64     `json:"id"`
+	ArticleSlug string    `json:"articleSlug"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ExportedFavorite struct {
+	ArticleSlug  string `json:"articleSlug"`
+	ArticleTitle string `json:"articleTitle"`
+}
+
+type ExportedBookmark struct {
+	ArticleSlug  string    `json:"articleSlug"`
+	ArticleTitle string    `json:"articleTitle"`
+	BookmarkedAt time.Time `json:"bookmarkedAt"`
+}
+
+type AccountDeletion struct {
+	UserID        int64     `json:"-"`
+	PurgeAfter    time.Time `json:"purgeAfter"`
+	ArticlePolicy string    `json:"articles"`
+}
+
+type Notification struct {
+	ID                int64
+	UserID            int64
+	Type              string
+	ArticleID         *int64
+	ArticleSlug       *string
+	ArticleTitle      *string
+	LastActorUsername *string
+	LastActorImage    *string
+	ActorCount        int64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	ReadAt            *time.Time
+}
+
+type Webhook struct {
+	ID                  int64      `json:"id"`
+	UserID              int64      `json:"-"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"secret,omitempty"`
+	Events              []string   `json:"events"`
+	Global              bool       `json:"global"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int64      `json:"consecutiveFailures"`
+	DisabledAt          *time.Time `json:"disabledAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhookId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int64           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt"`
+	LastStatusCode *int64          `json:"lastStatusCode"`
+	LastError      *string         `json:"lastError"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt"`
+}
+
+// ArticleViews counts the views of an article on a day (UTC) coming from a referrer, or directly when
+// the referrer is empty.
+type ArticleViews struct {
+	ArticleID int64
+	Day       time.Time
+	Referrer  string
+	Views     int64
+}
+
+// ArticleStats is the activity of an article over a range of days. Days without any are left out.
+type ArticleStats struct {
+	Slug      string       `json:"slug"`
+	Title     string       `json:"title"`
+	Views     int64        `json:"views"`
+	Favorites int64        `json:"favorites"`
+	Comments  int64        `json:"comments"`
+	Days      []DailyStats `json:"days"`
+}
+
+type DailyStats struct {
+	Date      string `json:"date"`
+	Views     int64  `json:"views"`
+	Favorites int64  `json:"favorites"`
+	Comments  int64  `json:"comments"`
+}
+
+type ReferrerStats struct {
+	Referrer string `json:"referrer"`
+	Views    int64  `json:"views"`
+}
+
+// FollowerGrowth is the number of followers before and after a range of days and the followers gained
+// on each day of it that had any.
+type FollowerGrowth struct {
+	Start int64            `json:"start"`
+	End   int64            `json:"end"`
+	Days  []DailyFollowers `json:"days"`
+}
+
+type DailyFollowers struct {
+	Date   string `json:"date"`
+	Gained int64  `json:"gained"`
+	Total  int64  `json:"total"`
+}